@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/linuxsuren/transfer/pkg"
+	"github.com/spf13/cobra"
+)
+
+type benchOption struct {
+	loss       float64
+	size       int64
+	transports []string
+}
+
+// NewBenchCmd creates the command for comparing the transports
+func NewBenchCmd() (cmd *cobra.Command) {
+	opt := &benchOption{}
+	cmd = &cobra.Command{
+		Use:   "bench [file]",
+		Short: "Compare the transports over the loopback link with the emulated packet loss",
+		Long: `Compare the transports over the loopback link with the emulated packet loss.
+A file with random data will be created if no file is provided.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: opt.runE,
+	}
+	flags := cmd.Flags()
+	flags.Float64VarP(&opt.loss, "loss", "", 0.01, "The probability of dropping a packet, between 0 and 1")
+	flags.Int64VarP(&opt.size, "size", "", 10*1024*1024, "The size of the random file in bytes")
+	flags.StringSliceVarP(&opt.transports, "transports", "", []string{pkg.TransportUDP, pkg.TransportTCP, pkg.TransportQUIC},
+		"The transports to compare, only the UDP based ones support the emulated loss, TCP runs without it as a reference")
+	return
+}
+
+func (o *benchOption) runE(cmd *cobra.Command, args []string) (err error) {
+	if o.loss < 0 || o.loss >= 1 {
+		err = fmt.Errorf("invalid loss: %v, it should be in [0, 1)", o.loss)
+		return
+	}
+
+	var file string
+	if len(args) > 0 {
+		file = args[0]
+	} else {
+		if file, err = randomFile(o.size); err != nil {
+			return
+		}
+		defer func() {
+			_ = os.Remove(file)
+		}()
+	}
+
+	cmd.Printf("sending %s with %.2f%% packet loss\n", file, o.loss*100)
+	results := pkg.RunBenchmark(file, o.loss, o.transports...)
+
+	writer := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(writer, "TRANSPORT\tLOSS\tSIZE\tDURATION\tTHROUGHPUT\tERROR")
+	for _, result := range results {
+		var errMsg string
+		if result.Err != nil {
+			errMsg = result.Err.Error()
+		}
+		_, _ = fmt.Fprintf(writer, "%s\t%.2f%%\t%d\t%v\t%.2f MB/s\t%s\n", result.Transport, result.Loss*100,
+			result.Size, result.Duration.Round(1e6), result.Throughput()/1024/1024, errMsg)
+	}
+	err = writer.Flush()
+	return
+}
+
+func randomFile(size int64) (file string, err error) {
+	var f *os.File
+	if f, err = os.CreateTemp("", "transfer-benchmark-*.bin"); err != nil {
+		return
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	file = f.Name()
+	_, err = io.CopyN(f, rand.Reader, size)
+	return
+}
@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/linuxsuren/transfer/pkg"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// configEnv is the environment variable of the config file path, the settings have the same prefix
+const configEnv = "TRANSFER_CONFIG"
+
+// config is the settings of the config file, the environment variables override them and the flags override both.
+// The keys are the names of the flags, such as TRANSFER_CHUNK_SIZE is the environment variable of chunk-size.
+type config struct {
+	Port         int      `yaml:"port"`
+	OutputDir    string   `yaml:"output-dir"`
+	Name         string   `yaml:"name"`
+	Secret       string   `yaml:"secret"`
+	SecretFile   string   `yaml:"secret-file"`
+	Rate         string   `yaml:"rate"`
+	ChunkSize    int      `yaml:"chunk-size"`
+	TrustedPeers []string `yaml:"trusted-peers"`
+	// DiscoveryPort and Group scope the waiters which the senders find
+	DiscoveryPort int    `yaml:"discovery-port"`
+	Group         string `yaml:"group"`
+}
+
+// configPath returns the path of the config file, it's ~/.config/transfer/config.yaml on Linux
+func configPath() (path string, err error) {
+	if path = os.Getenv(configEnv); path == "" {
+		var dir string
+		if dir, err = os.UserConfigDir(); err == nil {
+			path = filepath.Join(dir, "transfer", "config.yaml")
+		}
+	}
+	return
+}
+
+// loadConfig reads the config file and the environment variables over the default settings
+func loadConfig() (cfg config, path string, err error) {
+	cfg = config{Port: 3000, DiscoveryPort: pkg.DefaultDiscoveryPort}
+	path, err = readConfig(&cfg)
+	return
+}
+
+// readConfig reads the config file and the environment variables into the settings, it's fine if the file does not exist.
+// The secret is read from the secret file if it's not set.
+func readConfig(cfg *config) (path string, err error) {
+	if path, err = configPath(); err != nil {
+		return
+	}
+
+	var f *os.File
+	if f, err = os.Open(path); err == nil {
+		decoder := yaml.NewDecoder(f)
+		decoder.KnownFields(true)
+		if err = decoder.Decode(cfg); errors.Is(err, io.EOF) {
+			// an empty file
+			err = nil
+		}
+		_ = f.Close()
+		if err != nil {
+			err = fmt.Errorf("invalid config file %s, %v", path, err)
+			return
+		}
+	} else if errors.Is(err, os.ErrNotExist) {
+		err = nil
+	} else {
+		return
+	}
+
+	if err = cfg.loadEnv(); err == nil && cfg.Secret == "" && cfg.SecretFile != "" {
+		var secret []byte
+		if secret, err = os.ReadFile(cfg.SecretFile); err != nil {
+			err = fmt.Errorf("failed to read the secret file, %v", err)
+			return
+		}
+		cfg.Secret = strings.TrimSpace(string(secret))
+	}
+	return
+}
+
+// envName returns the environment variable of a key, such as: TRANSFER_CHUNK_SIZE
+func envName(key string) string {
+	return "TRANSFER_" + strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+}
+
+// loadEnv overrides the settings with the environment variables, the list is separated by commas
+func (c *config) loadEnv() (err error) {
+	value := reflect.ValueOf(c).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		key := value.Type().Field(i).Tag.Get("yaml")
+		env, ok := os.LookupEnv(envName(key))
+		if !ok {
+			continue
+		}
+
+		switch field := value.Field(i); field.Kind() {
+		case reflect.Int:
+			var number int
+			if number, err = strconv.Atoi(env); err != nil {
+				err = fmt.Errorf("invalid %s: '%s', it should be a number", envName(key), env)
+				return
+			}
+			field.SetInt(int64(number))
+		case reflect.Slice:
+			field.Set(reflect.ValueOf(strings.Split(env, ",")))
+		default:
+			field.SetString(env)
+		}
+	}
+	return
+}
+
+// values returns the settings which are set, the list is joined by commas
+func (c *config) values() (values map[string]string) {
+	values = map[string]string{}
+	value := reflect.ValueOf(c).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		if field.IsZero() {
+			continue
+		}
+
+		key := value.Type().Field(i).Tag.Get("yaml")
+		if field.Kind() == reflect.Slice {
+			values[key] = strings.Join(field.Interface().([]string), ",")
+		} else {
+			values[key] = fmt.Sprint(field.Interface())
+		}
+	}
+	return
+}
+
+// addDiscoveryFlags adds the flags of the port and the group of the announcements
+func addDiscoveryFlags(cmd *cobra.Command, discovery *pkg.Discovery) {
+	cmd.Flags().IntVarP(&discovery.Port, "discovery-port", "", pkg.DefaultDiscoveryPort,
+		"The UDP port of the announcements, it should be the same on both sides")
+	cmd.Flags().StringVarP(&discovery.Group, "group", "", "",
+		"The discovery group, the senders find the waiters of the same group only. It's the default group if it's empty")
+}
+
+// applyConfig sets the flags which are not given with the settings, the command might not have all of them.
+// The flags are marked as changed, so the settings win over the port of a discovered waiter as the flags do.
+func applyConfig(cmd *cobra.Command) (err error) {
+	// the flags have their own defaults, only the settings which are set apply
+	var cfg config
+	if _, err = readConfig(&cfg); err != nil {
+		return
+	}
+
+	for key, value := range cfg.values() {
+		if flag := cmd.Flags().Lookup(key); flag != nil && !flag.Changed {
+			if err = cmd.Flags().Set(key, value); err != nil {
+				err = fmt.Errorf("invalid setting %s: '%s', %v", key, value, err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// NewConfigCmd creates the command to manage the config file
+func NewConfigCmd() (cmd *cobra.Command) {
+	cmd = &cobra.Command{
+		Use:   "config",
+		Short: "Manage the settings in the config file, or the environment variables such as TRANSFER_PORT",
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "show",
+		Short: "Print the effective settings of the config file and the environment variables",
+		Args:  cobra.NoArgs,
+		RunE:  showConfig,
+	})
+	return
+}
+
+func showConfig(cmd *cobra.Command, _ []string) (err error) {
+	cfg, path, err := loadConfig()
+	if err != nil {
+		return
+	}
+	if cfg.Secret != "" {
+		cfg.Secret = "******"
+	}
+
+	var data []byte
+	if data, err = yaml.Marshal(cfg); err == nil {
+		cmd.Printf("# %s\n%s", path, data)
+	}
+	return
+}
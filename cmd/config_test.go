@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		file        string
+		env         map[string]string
+		args        []string
+		wantPort    int
+		wantName    string
+		wantPeers   []string
+		wantChanged bool
+	}{{
+		name:     "nothing is set",
+		wantPort: 3000,
+	}, {
+		name:        "config file",
+		file:        "port: 4000\nname: file\ntrusted-peers:\n  - 192.168.1.0/24\n",
+		wantPort:    4000,
+		wantName:    "file",
+		wantPeers:   []string{"192.168.1.0/24"},
+		wantChanged: true,
+	}, {
+		name:        "environment variables override the config file",
+		file:        "port: 4000\nname: file\n",
+		env:         map[string]string{"TRANSFER_NAME": "env", "TRANSFER_TRUSTED_PEERS": "10.0.0.0/8,192.168.1.2"},
+		wantPort:    4000,
+		wantName:    "env",
+		wantPeers:   []string{"10.0.0.0/8", "192.168.1.2"},
+		wantChanged: true,
+	}, {
+		name:        "flags override both",
+		file:        "port: 4000\nname: file\n",
+		env:         map[string]string{"TRANSFER_PORT": "5000", "TRANSFER_NAME": "env"},
+		args:        []string{"--port", "6000", "--name", "flag"},
+		wantPort:    6000,
+		wantName:    "flag",
+		wantChanged: true,
+	}, {
+		name:        "environment variable only",
+		env:         map[string]string{"TRANSFER_PORT": "5000"},
+		wantPort:    5000,
+		wantChanged: true,
+	}}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if tt.file != "" {
+				assert.Nil(t, os.WriteFile(path, []byte(tt.file), 0600), "failed in case [%d]", i)
+			}
+			t.Setenv(configEnv, path)
+			for _, key := range []string{"port", "name", "trusted-peers"} {
+				t.Setenv(envName(key), "")
+				assert.Nil(t, os.Unsetenv(envName(key)), "failed in case [%d]", i)
+			}
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			cmd := &cobra.Command{}
+			cmd.Flags().Int("port", 3000, "")
+			cmd.Flags().String("name", "", "")
+			cmd.Flags().StringSlice("trusted-peers", nil, "")
+			assert.Nil(t, cmd.ParseFlags(tt.args), "failed in case [%d]", i)
+			assert.Nil(t, applyConfig(cmd), "failed in case [%d]", i)
+
+			port, _ := cmd.Flags().GetInt("port")
+			name, _ := cmd.Flags().GetString("name")
+			peers, _ := cmd.Flags().GetStringSlice("trusted-peers")
+			assert.Equal(t, tt.wantPort, port, "failed in case [%d]", i)
+			assert.Equal(t, tt.wantName, name, "failed in case [%d]", i)
+			assert.Equal(t, tt.wantPeers, append([]string(nil), peers...), "failed in case [%d]", i)
+			// the port of a discovered waiter does not replace the one which is set
+			assert.Equal(t, tt.wantChanged, cmd.Flags().Changed("port"), "failed in case [%d]", i)
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.Nil(t, os.WriteFile(path, []byte("chunk-size: 1400\n"), 0600))
+	t.Setenv(configEnv, path)
+	t.Setenv(envName("chunk-size"), "invalid")
+	_, _, err := loadConfig()
+	assert.NotNil(t, err)
+
+	t.Setenv(envName("chunk-size"), "1000")
+	t.Setenv(envName("port"), "")
+	assert.Nil(t, os.Unsetenv(envName("port")))
+	cfg, configFile, err := loadConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, path, configFile)
+	// the environment variable wins, and the defaults are kept
+	assert.Equal(t, 1000, cfg.ChunkSize)
+	assert.Equal(t, 3000, cfg.Port)
+
+	assert.Nil(t, os.WriteFile(path, []byte("unknown: 1\n"), 0600))
+	_, _, err = loadConfig()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+
+	"github.com/linuxsuren/transfer/pkg"
+)
+
+// the exit codes of the commands, the scripts could retry on ExitTimeout but not on ExitRejected
+const (
+	ExitOK = 0
+	// ExitFailed is the code of the other errors, such as an invalid flag
+	ExitFailed = 1
+	// ExitPeerNotFound means there is no waiter which has the name, address or session code
+	ExitPeerNotFound = 2
+	// ExitRejected means the waiter rejected the file, such as an unsupported protocol version
+	ExitRejected = 3
+	// ExitAuthFailed means the secrets of both sides are different
+	ExitAuthFailed = 4
+	// ExitDiskFull means there is no enough space for the file, or it exceeds the quota
+	ExitDiskFull = 5
+	// ExitChecksumMismatch means the received file is different from the sent one
+	ExitChecksumMismatch = 6
+	// ExitTimeout means the peer was gone or the session took too long, the same with timeout(1)
+	ExitTimeout = 124
+	// ExitCancelled means it was interrupted, the same with a shell which is interrupted by Ctrl+C
+	ExitCancelled = 130
+)
+
+// ExitCode returns the exit code of an error, the more specific error wins if it matches multiple ones,
+// such as the rejection of a file which is too large is ExitDiskFull. The cancelled context is ExitCancelled as well.
+func ExitCode(err error) (code int) {
+	switch {
+	case err == nil:
+		code = ExitOK
+	case errors.Is(err, pkg.ErrCancelled), errors.Is(err, context.Canceled):
+		code = ExitCancelled
+	case errors.Is(err, pkg.ErrTimeout):
+		code = ExitTimeout
+	case errors.Is(err, pkg.ErrAuthFailed):
+		code = ExitAuthFailed
+	case errors.Is(err, pkg.ErrInsufficientSpace):
+		code = ExitDiskFull
+	case errors.Is(err, pkg.ErrChecksumMismatch):
+		code = ExitChecksumMismatch
+	case errors.Is(err, pkg.ErrRejected):
+		code = ExitRejected
+	case errors.Is(err, pkg.ErrPeerNotFound):
+		code = ExitPeerNotFound
+	default:
+		code = ExitFailed
+	}
+	return
+}
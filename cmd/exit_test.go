@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/linuxsuren/transfer/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{{
+		name: "no error",
+		want: ExitOK,
+	}, {
+		name: "peer not found",
+		err:  fmt.Errorf("%w: no waiters found in 3s", pkg.ErrPeerNotFound),
+		want: ExitPeerNotFound,
+	}, {
+		name: "rejected",
+		err:  fmt.Errorf("%w: unsupported protocol version", pkg.ErrRejected),
+		want: ExitRejected,
+	}, {
+		name: "authentication failed",
+		err:  fmt.Errorf("%w: invalid signature", pkg.ErrAuthFailed),
+		want: ExitAuthFailed,
+	}, {
+		name: "rejected for the disk space",
+		err:  fmt.Errorf("%w, %w", pkg.ErrRejected, pkg.ErrInsufficientSpace),
+		want: ExitDiskFull,
+	}, {
+		name: "checksum mismatch",
+		err:  fmt.Errorf("%w, the waiter wrote another file", pkg.ErrChecksumMismatch),
+		want: ExitChecksumMismatch,
+	}, {
+		name: "timeout",
+		err:  fmt.Errorf("%w: no response from the waiter in 30s", pkg.ErrTimeout),
+		want: ExitTimeout,
+	}, {
+		name: "cancelled",
+		err:  fmt.Errorf("%w, context canceled", pkg.ErrCancelled),
+		want: ExitCancelled,
+	}, {
+		name: "cancelled context",
+		err:  fmt.Errorf("failed to find the waiter, %w", context.Canceled),
+		want: ExitCancelled,
+	}, {
+		name: "other error",
+		err:  errors.New("invalid flag"),
+		want: ExitFailed,
+	}}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ExitCode(tt.err), "failed in case [%d]", i)
+		})
+	}
+}
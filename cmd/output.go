@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/linuxsuren/transfer/pkg"
+	"github.com/spf13/cobra"
+)
+
+// the output formats
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+func addOutputFlag(cmd *cobra.Command, format *string) {
+	cmd.Flags().StringVarP(format, "output", "o", outputText,
+		"The output format, json prints the events as newline-delimited JSON to stdout. Supported: text, json")
+}
+
+// output prints the messages for humans, or the events as JSON lines for the scripts
+type output struct {
+	cmd  *cobra.Command
+	json bool
+	lock sync.Mutex
+}
+
+func newOutput(cmd *cobra.Command, format string) (out *output, err error) {
+	switch format {
+	case outputText, outputJSON:
+		out = &output{cmd: cmd, json: format == outputJSON}
+	default:
+		err = fmt.Errorf("unsupported output format: '%s', should be one of %s, %s", format, outputText, outputJSON)
+	}
+	return
+}
+
+// Printf prints a message in the text format only
+func (o *output) Printf(format string, a ...interface{}) {
+	if !o.json {
+		o.cmd.Printf(format, a...)
+	}
+}
+
+// event prints a JSON line in the json format only
+func (o *output) event(v interface{}) {
+	if !o.json {
+		return
+	}
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	_ = json.NewEncoder(o.cmd.OutOrStdout()).Encode(v)
+}
+
+// events returns the channel of the events, it's nil in the text format since there is no need to send them
+func (o *output) events() (events chan pkg.Event) {
+	if o.json {
+		events = make(chan pkg.Event, 10)
+	}
+	return
+}
+
+// watch prints the messages or the events until both channels are closed, the done channel is closed then
+func (o *output) watch(msg chan string, events chan pkg.Event) (done chan struct{}) {
+	done = make(chan struct{})
+	go func() {
+		defer close(done)
+		for msg != nil || events != nil {
+			select {
+			case m, ok := <-msg:
+				if !ok {
+					msg = nil
+				} else if m != "end" {
+					o.Printf("%s", m)
+				}
+			case e, ok := <-events:
+				if !ok {
+					events = nil
+				} else {
+					o.event(e)
+				}
+			}
+		}
+	}()
+	return
+}
+
+// summary prints the result of a session, the error is a part of it
+func (o *output) summary(summary pkg.Summary, err error) {
+	if err != nil {
+		summary.Error = err.Error()
+	}
+	o.event(summary)
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linuxsuren/transfer/pkg"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutputJSON(t *testing.T) {
+	data := bytes.Repeat([]byte("hello transfer "), 1000)
+	tests := []struct {
+		name      string
+		secret    string
+		wantTypes []string
+		wantBytes int64
+		wantErr   bool
+	}{{
+		name:      "succeeded",
+		secret:    "secret",
+		wantTypes: []string{pkg.EventStart, pkg.EventComplete, pkg.EventSummary},
+		wantBytes: int64(len(data)),
+	}, {
+		name:      "rejected",
+		secret:    "another",
+		wantTypes: []string{pkg.EventSummary},
+		wantErr:   true,
+	}}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "hello.txt")
+			assert.Nil(t, os.WriteFile(file, data, 0600), "failed in case [%d]", i)
+
+			conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+			assert.Nil(t, err, "failed in case [%d]", i)
+			port := conn.LocalAddr().(*net.UDPAddr).Port
+			_ = conn.Close()
+
+			waiterMsg := make(chan string, 10)
+			waiter := pkg.NewUDPWaiter(port).ListenAddress("127.0.0.1").WithOutputDir(t.TempDir()).
+				WithSecret("secret").WithTimeout(10 * time.Second)
+			go func() {
+				_ = waiter.Start(waiterMsg)
+			}()
+			// the first message means the waiter is listening
+			<-waiterMsg
+			go func() {
+				for range waiterMsg {
+				}
+			}()
+
+			buf := &bytes.Buffer{}
+			cmd := &cobra.Command{}
+			cmd.SetOut(buf)
+			out, err := newOutput(cmd, outputJSON)
+			assert.Nil(t, err, "failed in case [%d]", i)
+
+			sender := pkg.NewUDPSender("127.0.0.1").WithPort(port).WithSecret(tt.secret).WithTimeout(10 * time.Second)
+			msg, events := make(chan string, 10), out.events()
+			done := out.watch(msg, events)
+			err = sender.WithEvents(events).Send(msg, file)
+			<-done
+			out.summary(sender.Summary(), err)
+			assert.Equal(t, tt.wantErr, err != nil, "failed in case [%d]", i)
+
+			var types []string
+			var summary pkg.Summary
+			for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+				// each line is a JSON object, the progress might be there or not
+				var event map[string]interface{}
+				assert.Nil(t, json.Unmarshal([]byte(line), &event), "failed in case [%d]", i)
+				if event["type"] != pkg.EventProgress {
+					types = append(types, event["type"].(string))
+				}
+				assert.Nil(t, json.Unmarshal([]byte(line), &summary), "failed in case [%d]", i)
+			}
+			// the summary is the last line even if it fails
+			assert.Equal(t, tt.wantTypes, types, "failed in case [%d]", i)
+			assert.Equal(t, tt.wantErr, summary.Error != "", "failed in case [%d]", i)
+			assert.Equal(t, tt.wantBytes, summary.Bytes, "failed in case [%d]", i)
+		})
+	}
+}
+
+func TestOutputText(t *testing.T) {
+	buf := &bytes.Buffer{}
+	cmd := &cobra.Command{}
+	cmd.SetOut(buf)
+	out, err := newOutput(cmd, outputText)
+	assert.Nil(t, err)
+	assert.Nil(t, out.events())
+
+	msg := make(chan string, 2)
+	done := out.watch(msg, nil)
+	msg <- "hello\n"
+	msg <- "end"
+	close(msg)
+	<-done
+	out.summary(pkg.Summary{}, nil)
+	assert.Equal(t, "hello\n", buf.String())
+
+	_, err = newOutput(cmd, "yaml")
+	assert.NotNil(t, err)
+}
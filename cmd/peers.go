@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/linuxsuren/transfer/pkg"
+	"github.com/spf13/cobra"
+)
+
+type peersOption struct {
+	duration  time.Duration
+	discovery pkg.Discovery
+	output    string
+}
+
+// NewPeersCmd creates the command for listing the waiters
+func NewPeersCmd() (cmd *cobra.Command) {
+	opt := &peersOption{}
+	cmd = &cobra.Command{
+		Use:   "peers",
+		Short: "List the waiters in the local network",
+		RunE:  opt.runE,
+	}
+	flags := cmd.Flags()
+	flags.DurationVarP(&opt.duration, "duration", "d", 5*time.Second, "The duration to listen for the waiters")
+	addDiscoveryFlags(cmd, &opt.discovery)
+	addOutputFlag(cmd, &opt.output)
+	return
+}
+
+func (o *peersOption) runE(cmd *cobra.Command, _ []string) (err error) {
+	if err = applyConfig(cmd); err != nil {
+		return
+	}
+
+	var out *output
+	if out, err = newOutput(cmd, o.output); err != nil {
+		return
+	}
+
+	out.Printf("looking for the waiters in %v\n", o.duration)
+	peers := o.discovery.DiscoverPeers(cmd.Context(), o.duration).List()
+	if out.json {
+		for _, peer := range peers {
+			out.event(pkg.NewPeerEvent(peer))
+		}
+		return
+	}
+
+	if len(peers) == 0 {
+		cmd.Println("no waiters found")
+		return
+	}
+	printPeers(cmd, peers)
+	return
+}
+
+func printPeers(cmd *cobra.Command, peers []pkg.Peer) {
+	writer := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(writer, "#\tNAME\tIP\tPORT\tLAST SEEN")
+	for i, peer := range peers {
+		_, _ = fmt.Fprintf(writer, "%d\t%s\t%s\t%d\t%s ago\n", i+1, peer.Name, peer.IP, peer.Port,
+			time.Since(peer.LastSeen).Round(time.Second))
+	}
+	_ = writer.Flush()
+}
+
+// choosePeer asks the user to choose one of the peers, the first one is the default choice.
+// It does not ask if there is only one peer, or fails if nobody could answer the prompt.
+func choosePeer(cmd *cobra.Command, peers []pkg.Peer, interactive bool) (peer pkg.Peer, err error) {
+	if len(peers) == 1 {
+		peer = peers[0]
+		return
+	}
+	if !interactive || !isTerminal(cmd.InOrStdin()) {
+		err = fmt.Errorf("found %d waiters, choose one with --to or the IP address", len(peers))
+		return
+	}
+
+	printPeers(cmd, peers)
+	cmd.Printf("choose the waiter [1-%d] (default 1): ", len(peers))
+
+	var line string
+	if line, err = bufio.NewReader(cmd.InOrStdin()).ReadString('\n'); err != nil && line == "" {
+		err = fmt.Errorf("failed to read the choice, %v", err)
+		return
+	}
+
+	index := 1
+	if line = strings.TrimSpace(line); line != "" {
+		if index, err = strconv.Atoi(line); err != nil || index < 1 || index > len(peers) {
+			err = fmt.Errorf("invalid choice: '%s'", line)
+			return
+		}
+	}
+	peer, err = peers[index-1], nil
+	return
+}
+
+// isTerminal checks if the input is a terminal, the other readers than a file are treated as a terminal
+func isTerminal(in io.Reader) bool {
+	if f, ok := in.(*os.File); ok {
+		info, err := f.Stat()
+		return err == nil && info.Mode()&os.ModeCharDevice != 0
+	}
+	return true
+}
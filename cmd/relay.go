@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"net"
+	"strconv"
+
+	"github.com/linuxsuren/transfer/pkg"
+	"github.com/spf13/cobra"
+)
+
+type relayOption struct {
+	port   int
+	listen string
+}
+
+// NewRelayCmd creates the command for running a relay server
+func NewRelayCmd() (cmd *cobra.Command) {
+	opt := &relayOption{}
+	cmd = &cobra.Command{
+		Use:   "relay",
+		Short: "Run a relay server for the senders and waiters which are not in the same network",
+		RunE:  opt.runE,
+	}
+	flags := cmd.Flags()
+	flags.IntVarP(&opt.port, "port", "p", pkg.DefaultRelayPort, "The port to listen")
+	flags.StringVarP(&opt.listen, "listen", "l", "",
+		"The address that want to listen, listen to all the IPv4 and IPv6 addresses if it's empty")
+	return
+}
+
+func (o *relayOption) runE(cmd *cobra.Command, _ []string) (err error) {
+	server := pkg.NewRelayServer(net.JoinHostPort(o.listen, strconv.Itoa(o.port)))
+	if err = server.Start(cmd.Context()); err != nil {
+		return
+	}
+
+	cmd.Println("relay server listening", server.Addr())
+	<-cmd.Context().Done()
+	return
+}
@@ -1,10 +1,10 @@
 package cmd
 
 import (
-	"context"
 	"fmt"
 	"github.com/linuxsuren/transfer/pkg"
 	"github.com/spf13/cobra"
+	"time"
 )
 
 func NewSendCmd() (cmd *cobra.Command) {
@@ -18,53 +18,149 @@ func NewSendCmd() (cmd *cobra.Command) {
 	}
 	flags := cmd.Flags()
 	flags.IntVarP(&opt.port, "port", "p", 3000, "The port to send")
+	flags.StringVarP(&opt.to, "to", "", "", "The name, hostname or IP address of the waiter")
+	flags.DurationVarP(&opt.duration, "discovery-duration", "", 5*time.Second,
+		"The duration to listen for the waiters")
+	addDiscoveryFlags(cmd, &opt.discovery)
+	flags.StringVarP(&opt.transport, "transport", "", pkg.TransportAuto,
+		"The transport to send data, auto means falling back to TCP if UDP does not work. Supported: auto, udp, tcp, quic")
+	flags.StringVarP(&opt.relay, "relay", "", "", "The address of the relay server, such as: relay.example.com:9982")
+	flags.StringVarP(&opt.code, "code", "", "", "The session code which is shared with the waiter, it's required when using a relay server")
+	flags.IntVarP(&opt.chunk, "chunk-size", "", 0,
+		"The size of the data in each datagram, the default one depends on the OS. A size fits the MTU avoids the IP fragmentation")
+	flags.BoolVarP(&opt.offload, "udp-offload", "", false,
+		"Send multiple datagrams at once with UDP GSO, it works with the udp transport and a small chunk size on Linux only")
+	flags.BoolVarP(&opt.mmap, "mmap", "", false,
+		"Read the file through a memory mapping, it avoids a syscall for each chunk of the large files on Linux and macOS")
+	flags.StringVarP(&opt.compress, "compress", "", "",
+		"Compress each chunk with zstd or lz4, it's zstd if no value is given. The incompressible data is sent as is")
+	flags.Lookup("compress").NoOptDefVal = pkg.CompressZstd
+	flags.BoolVarP(&opt.delta, "delta", "", false,
+		"Send the changed chunks only if the waiter has an older version of the file. "+
+			"The blocks are compared at the offsets of the chunks, the ones after an inserted or deleted byte are sent again")
+	flags.StringVarP(&opt.secret, "secret", "", "",
+		"The shared secret to sign the session, it should be the same with the waiter")
+	flags.StringVarP(&opt.rate, "rate", "", "",
+		"The maximum sending rate in bytes per second, such as: 10M. It's not limited if it's empty")
+	flags.IntVarP(&opt.parallel, "parallel", "", 1,
+		"The count of the workers, each one sends the data to its own port which starts from the port. It should be the same with the waiter")
+	flags.DurationVarP(&opt.idle, "idle-timeout", "", pkg.DefaultIdleTimeout,
+		"Fail if there is no response from the waiter in the duration, 0 means no limit")
+	flags.DurationVarP(&opt.timeout, "timeout", "", 0,
+		"Fail if sending the file takes longer than the duration, 0 means no limit")
+	addOutputFlag(cmd, &opt.output)
 	return
 }
 
 type sendOption struct {
-	ip   string
-	port int
+	ip        string
+	port      int
+	to        string
+	duration  time.Duration
+	discovery pkg.Discovery
+	transport string
+	relay     string
+	code      string
+	parallel  int
+	chunk     int
+	offload   bool
+	mmap      bool
+	compress  string
+	delta     bool
+	secret    string
+	rate      string
+	idle      time.Duration
+	timeout   time.Duration
+	output    string
+	out       *output
 }
 
 func (o *sendOption) preRunE(cmd *cobra.Command, args []string) (err error) {
-	if len(args) >= 2 {
-		o.ip = args[1]
+	if err = applyConfig(cmd); err != nil {
+		return
+	}
+	if o.out, err = newOutput(cmd, o.output); err != nil {
 		return
 	}
 
-	cmd.Println("no target ip provided, trying to find it")
+	if o.relay != "" {
+		if o.code == "" {
+			err = fmt.Errorf("the session code is required when using a relay server")
+		} else if o.parallel > 1 {
+			err = fmt.Errorf("the parallel sending is not supported by the relay server")
+		}
+		return
+	}
 
-	ctx, cancel := context.WithCancel(cmd.Context())
+	if len(args) >= 2 {
+		o.ip = args[1]
+		return
+	}
 
-	waiter := make(chan string, 10)
-	pkg.FindWaiters(ctx, waiter)
+	var peer pkg.Peer
+	if o.to != "" {
+		o.out.Printf("looking for the waiter '%s'\n", o.to)
+		if peer, err = o.discovery.FindPeer(cmd.Context(), o.duration, o.to); err != nil {
+			return
+		}
+	} else {
+		o.out.Printf("no target ip provided, trying to find it\n")
+		peers := o.discovery.DiscoverPeers(cmd.Context(), o.duration).List()
+		if len(peers) == 0 {
+			err = fmt.Errorf("%w: no waiters found in %v", pkg.ErrPeerNotFound, o.duration)
+			return
+		}
+		// nobody answers the prompt in the JSON output
+		if peer, err = choosePeer(cmd, peers, !o.out.json); err != nil {
+			return
+		}
+	}
 
-	o.ip = <-waiter
-	cancel()
+	o.ip = peer.IP
+	if !cmd.Flags().Changed("port") {
+		o.port = peer.Port
+	}
+	o.out.Printf("found %s (%s) at %s\n", peer.Name, peer.Hostname, peer.Address())
+	o.out.event(pkg.NewPeerEvent(peer))
 	return
 }
 
 func (o *sendOption) runE(cmd *cobra.Command, args []string) (err error) {
 	if len(args) <= 0 {
-		cmd.PrintErrln("filename is required")
+		err = fmt.Errorf("filename is required")
 		return
 	}
 
 	file := args[0]
 
-	sender := pkg.NewUDPSender(o.ip).WithPort(o.port)
-	msg := make(chan string, 10)
-
-	go func() {
-		for a := range msg {
-			if a == "end" {
-				break
-			}
-			cmd.Print(a)
+	var rate int64
+	if o.rate != "" {
+		if rate, err = pkg.ParseSize(o.rate); err != nil {
+			return
 		}
-	}()
+	}
 
-	err = sender.Send(msg, file)
-	fmt.Printf("sent over in %fs\n", sender.ConsumedTime().Seconds())
+	var transport pkg.Transport
+	if o.relay != "" {
+		transport = pkg.NewRelayTransport(o.relay, o.code)
+	} else if transport, err = pkg.NewTransport(o.transport); err != nil {
+		return
+	}
+	if udp, ok := transport.(*pkg.UDPTransport); ok {
+		udp.Offload = o.offload
+	}
+
+	sender := pkg.NewUDPSender(o.ip).WithPort(o.port).WithTransport(transport).WithParallel(o.parallel).WithChunk(o.chunk).WithMmap(o.mmap).WithCompress(o.compress).WithDelta(o.delta).
+		WithSecret(o.secret).WithRate(rate).WithIdleTimeout(o.idle).WithTimeout(o.timeout).WithContext(cmd.Context())
+	msg, events := make(chan string, 10), o.out.events()
+	done := o.out.watch(msg, events)
+
+	err = sender.WithEvents(events).Send(msg, file)
+	<-done
+	if o.out.json {
+		o.out.summary(sender.Summary(), err)
+	} else if err == nil {
+		fmt.Printf("sent over in %fs\n", sender.ConsumedTime().Seconds())
+	}
 	return
 }
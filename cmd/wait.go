@@ -1,30 +1,112 @@
 package cmd
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/linuxsuren/transfer/pkg"
 	"github.com/spf13/cobra"
 )
 
 type waitOption struct {
-	port   int
-	listen string
+	port      int
+	listen    string
+	name      string
+	broadcast []string
+	discovery pkg.Discovery
+	mdns      bool
+	transport string
+	relay     string
+	code      string
+	parallel  int
+	offload   bool
+	prealloc  bool
+	quota     string
+	secret    string
+	outputDir string
+	trusted   []string
+	idle      time.Duration
+	timeout   time.Duration
+	output    string
 }
 
 func (o *waitOption) preRunE(cmd *cobra.Command, _ []string) (err error) {
-	err = pkg.Broadcast(cmd.Context())
+	if err = applyConfig(cmd); err != nil {
+		return
+	}
+
+	peer := pkg.NewLocalPeer(o.name, o.port)
+	peer.Group = o.discovery.Group
+	if err = pkg.NewBroadcaster(peer).
+		WithPort(o.discovery.Port).
+		WithTargets(o.broadcast...).
+		WithOutputDir(o.outputDir).
+		Start(cmd.Context()); err != nil {
+		return
+	}
+
+	if o.mdns {
+		if mdnsErr := pkg.NewMDNSResponder(peer).WithOutputDir(o.outputDir).Start(cmd.Context()); mdnsErr != nil {
+			cmd.PrintErrln("failed to advertise the mDNS service,", mdnsErr)
+		}
+	}
 	return
 }
 
 func (o *waitOption) runE(cmd *cobra.Command, args []string) error {
-	waiter := pkg.NewUDPWaiter(o.port).ListenAddress(o.listen)
-	msg := make(chan string, 10)
+	out, err := newOutput(cmd, o.output)
+	if err != nil {
+		return err
+	}
+
+	var quota int64
+	if o.quota != "" {
+		var err error
+		if quota, err = pkg.ParseSize(o.quota); err != nil {
+			return err
+		}
+	}
+
+	trusted, err := pkg.ParseTrustedPeers(o.trusted)
+	if err != nil {
+		return err
+	}
 
-	go func() {
-		for a := range msg {
-			cmd.Print(a)
+	var transport pkg.Transport
+	if o.relay != "" {
+		if o.parallel > 1 {
+			return fmt.Errorf("the parallel receiving is not supported by the relay server")
+		}
+		if len(trusted) > 0 {
+			// the data comes from the relay server
+			return fmt.Errorf("the trusted peers are not supported by the relay server")
+		}
+		if o.code == "" {
+			o.code = pkg.RandomCode(6)
 		}
-	}()
-	return waiter.Start(msg)
+		// the code is printed in the json format as well, the sender needs it
+		cmd.PrintErrf("waiting via relay %s, the session code is: %s\n", o.relay, o.code)
+		transport = pkg.NewRelayTransport(o.relay, o.code)
+	} else {
+		var err error
+		if transport, err = pkg.NewTransport(o.transport); err != nil {
+			return err
+		}
+	}
+	if udp, ok := transport.(*pkg.UDPTransport); ok {
+		udp.Offload = o.offload
+	}
+
+	waiter := pkg.NewUDPWaiter(o.port).ListenAddress(o.listen).WithTransport(transport).WithParallel(o.parallel).
+		WithOutputDir(o.outputDir).WithPreallocate(o.prealloc).WithQuota(quota).WithSecret(o.secret).WithTrustedPeers(trusted).
+		WithIdleTimeout(o.idle).WithTimeout(o.timeout).WithContext(cmd.Context())
+	msg, events := make(chan string, 10), out.events()
+	done := out.watch(msg, events)
+
+	err = waiter.WithEvents(events).Start(msg)
+	<-done
+	out.summary(waiter.Summary(), err)
+	return err
 }
 
 func NewWaitCmd() (cmd *cobra.Command) {
@@ -37,6 +119,35 @@ func NewWaitCmd() (cmd *cobra.Command) {
 	}
 	flags := cmd.Flags()
 	flags.IntVarP(&opt.port, "port", "p", 3000, "The port to listen")
-	flags.StringVarP(&opt.listen, "listen", "l", "0.0.0.0", "The address that want to listen")
+	flags.StringVarP(&opt.listen, "listen", "l", "",
+		"The address that want to listen, listen to all the IPv4 and IPv6 addresses if it's empty")
+	flags.StringVarP(&opt.name, "name", "", "", "The device name to announce, the hostname will be used if it's empty")
+	flags.StringSliceVarP(&opt.broadcast, "broadcast", "", nil,
+		"The extra addresses to send the announcement to, such as the limited broadcast address 255.255.255.255")
+	addDiscoveryFlags(cmd, &opt.discovery)
+	flags.BoolVarP(&opt.mdns, "mdns", "", true, "Advertise the waiter as a DNS-SD service "+pkg.MDNSService)
+	flags.StringVarP(&opt.transport, "transport", "", pkg.TransportAuto,
+		"The transport to receive data, auto means listening to both UDP and TCP. Supported: auto, udp, tcp, quic")
+	flags.StringVarP(&opt.relay, "relay", "", "", "The address of the relay server, such as: relay.example.com:9982")
+	flags.StringVarP(&opt.code, "code", "", "", "The session code which is shared with the sender, a random one will be generated if it's empty")
+	flags.BoolVarP(&opt.offload, "udp-offload", "", false,
+		"Receive the coalesced datagrams with UDP GRO, it works with the udp transport on Linux only")
+	flags.IntVarP(&opt.parallel, "parallel", "", 1,
+		"The count of the ports to listen, they start from the port. It should be the same with the sender")
+	flags.BoolVarP(&opt.prealloc, "preallocate", "", false,
+		"Allocate the disk space of the whole file before receiving, the file is sparse by default")
+	flags.StringVarP(&opt.quota, "quota", "", "",
+		"The maximum size of a file to receive, such as: 500M, 10G. It's not limited if it's empty")
+	flags.StringVarP(&opt.secret, "secret", "", "",
+		"The shared secret which the sender should sign the session with, any sender is accepted if it's empty")
+	flags.StringVarP(&opt.outputDir, "output-dir", "", "",
+		"The directory to write the files, it's the current directory by default")
+	flags.StringSliceVarP(&opt.trusted, "trusted-peers", "", nil,
+		"The IP addresses or the CIDR networks of the senders to accept, such as: 192.168.1.0/24. Any sender is accepted if it's empty")
+	flags.DurationVarP(&opt.idle, "idle-timeout", "", pkg.DefaultIdleTimeout,
+		"Fail if there is no data or keepalive from the sender in the duration, 0 means no limit")
+	flags.DurationVarP(&opt.timeout, "timeout", "", 0,
+		"Fail if receiving a file takes longer than the duration, 0 means no limit")
+	addOutputFlag(cmd, &opt.output)
 	return
 }
@@ -1,6 +1,11 @@
 package main
 
 import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
 	cmd2 "github.com/linuxsuren/transfer/cmd"
 	"github.com/spf13/cobra"
 )
@@ -8,16 +13,21 @@ import (
 func NewRoot() (cmd *cobra.Command) {
 	cmd = &cobra.Command{
 		Use: "transfer",
+		// the usage is printed for the invalid flags and arguments only
+		PersistentPreRun: func(cmd *cobra.Command, _ []string) {
+			cmd.SilenceUsage = true
+		},
 	}
 
-	cmd.AddCommand(cmd2.NewSendCmd(), cmd2.NewWaitCmd())
+	cmd.AddCommand(cmd2.NewSendCmd(), cmd2.NewWaitCmd(), cmd2.NewPeersCmd(), cmd2.NewBenchCmd(), cmd2.NewRelayCmd(),
+		cmd2.NewConfigCmd())
 	return
 }
 
 func main() {
-	cmd := NewRoot()
-	err := cmd.Execute()
-	if err != nil {
-		panic(err)
-	}
+	// Ctrl+C cancels the session, the command exits with cmd2.ExitCancelled
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := NewRoot().ExecuteContext(ctx)
+	stop()
+	os.Exit(cmd2.ExitCode(err))
 }
@@ -0,0 +1,219 @@
+package pkg
+
+import (
+	"net"
+	"sync/atomic"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	// batchSize is the max count of the datagrams in one syscall
+	batchSize = 32
+	// maxDatagramSize is able to hold a datagram, or the coalesced datagrams of GRO
+	maxDatagramSize = 65535
+	// maxGSOSize is the max size of the datagrams which are sent with GSO at once
+	maxGSOSize = 65507
+	// maxGSOSegments is the max count of the datagrams which are sent with GSO at once
+	maxGSOSegments = 64
+)
+
+// batchConn reads or writes multiple datagrams in one syscall, it's recvmmsg and sendmmsg on Linux.
+// Both ipv4.PacketConn and ipv6.PacketConn implement it.
+type batchConn interface {
+	ReadBatch(ms []ipv4.Message, flags int) (int, error)
+	WriteBatch(ms []ipv4.Message, flags int) (int, error)
+}
+
+// frameBatchWriter writes multiple frames at once
+type frameBatchWriter interface {
+	// WriteFrames returns the count of the frames which were written
+	WriteFrames(frames [][]byte) (int, error)
+}
+
+// frameBatchReader reads multiple frames at once
+type frameBatchReader interface {
+	// ReadFrames reads the frames into the buffers, returns the count of the buffers which were used
+	ReadFrames(buffers []*receiveBuffer) (frames []ReceivedData, used int, err error)
+}
+
+// newBatchConn returns nil if the batch syscalls are not supported on this platform
+func newBatchConn(conn *net.UDPConn) batchConn {
+	if !batchSupported {
+		return nil
+	}
+	if addr, ok := conn.LocalAddr().(*net.UDPAddr); ok && addr.IP.To4() == nil {
+		return ipv6.NewPacketConn(conn)
+	}
+	return ipv4.NewPacketConn(conn)
+}
+
+// udpConn is the sender side UDP connection which is able to write frames in batches
+type udpConn struct {
+	*net.UDPConn
+	batch batchConn
+	gso   atomic.Bool
+}
+
+func newUDPConn(conn *net.UDPConn, offload bool) net.Conn {
+	batch := newBatchConn(conn)
+	if batch == nil {
+		return conn
+	}
+
+	c := &udpConn{UDPConn: conn, batch: batch}
+	c.gso.Store(offload && enableGSO(conn))
+	return c
+}
+
+// WriteFrames writes the frames with sendmmsg, the frames with the same size are sent as one with GSO
+func (c *udpConn) WriteFrames(frames [][]byte) (n int, err error) {
+	gso := c.gso.Load()
+	messages, counts := batchMessages(frames, gso)
+	for i := 0; i < len(messages); {
+		var sent int
+		if sent, err = c.batch.WriteBatch(messages[i:], 0); err != nil {
+			if gso && gsoFailed(err) {
+				// the segments might be larger than the MTU, or the kernel does not support it
+				c.gso.Store(false)
+			}
+			return
+		}
+		for _, count := range counts[i : i+sent] {
+			n += count
+		}
+		i += sent
+	}
+	return
+}
+
+// batchMessages puts the frames into the messages, returns the count of frames of each message
+func batchMessages(frames [][]byte, gso bool) (messages []ipv4.Message, counts []int) {
+	for i := 0; i < len(frames); {
+		j := i + 1
+		size := len(frames[i])
+		if gso {
+			for total := size; j < len(frames) && j-i < maxGSOSegments &&
+				len(frames[j]) <= size && total+len(frames[j]) <= maxGSOSize; {
+				total += len(frames[j])
+				j++
+				// all the segments have the same size except the last one
+				if len(frames[j-1]) < size {
+					break
+				}
+			}
+		}
+
+		message := ipv4.Message{Buffers: frames[i:j]}
+		if j-i > 1 {
+			message.OOB = gsoControl(size)
+		}
+		messages = append(messages, message)
+		counts = append(counts, j-i)
+		i = j
+	}
+	return
+}
+
+// batchReader reads the frames in batches, and splits the datagrams which were coalesced by GRO
+type batchReader struct {
+	batch    batchConn
+	gro      bool
+	messages []ipv4.Message
+	frames   []ReceivedData
+}
+
+// read returns the frames which hold the references of the buffers,
+// the returned slice is reused by the following reads
+func (r *batchReader) read(buffers []*receiveBuffer) (frames []ReceivedData, used int, err error) {
+	if len(r.messages) < len(buffers) {
+		r.messages = make([]ipv4.Message, len(buffers))
+		for i := range r.messages {
+			r.messages[i].Buffers = make([][]byte, 1)
+			if r.gro {
+				r.messages[i].OOB = make([]byte, groControlSize)
+			}
+		}
+	}
+	messages := r.messages[:len(buffers)]
+	for i := range messages {
+		messages[i].Buffers[0] = buffers[i].data
+	}
+	if used, err = r.batch.ReadBatch(messages, 0); err != nil {
+		return
+	}
+
+	frames = r.frames[:0]
+	for i, message := range messages[:used] {
+		data := message.Buffers[0][:message.N]
+		if r.gro {
+			for segment := groSegmentSize(message.OOB[:message.NN]); segment > 0 && len(data) > segment; {
+				buffers[i].hold()
+				frames = append(frames, ReceivedData{Data: data[:segment], Remote: message.Addr, buffer: buffers[i]})
+				data = data[segment:]
+			}
+		}
+		buffers[i].hold()
+		frames = append(frames, ReceivedData{Data: data, Remote: message.Addr, buffer: buffers[i]})
+	}
+	r.frames = frames
+	return
+}
+
+// frameReader reads the frames in batches if the connection supports it
+type frameReader struct {
+	conn    net.PacketConn
+	batch   frameBatchReader
+	ring    *bufferRing
+	buffers []*receiveBuffer
+	frames  []ReceivedData
+}
+
+// newFrameReader creates a reader which takes the buffers from the ring, it allocates the buffers if the ring is nil
+func newFrameReader(conn net.PacketConn, ring *bufferRing) *frameReader {
+	reader := &frameReader{conn: conn, ring: ring}
+	count := 1
+	if batch, ok := conn.(frameBatchReader); ok {
+		reader.batch = batch
+		count = batchSize
+	}
+	reader.buffers = make([]*receiveBuffer, count)
+	reader.frames = make([]ReceivedData, 1)
+	return reader
+}
+
+// read returns the received frames, each frame should be released once it's not used.
+// The returned slice is reused by the following reads.
+func (r *frameReader) read() (frames []ReceivedData, err error) {
+	for i := range r.buffers {
+		if r.buffers[i] == nil {
+			if r.ring != nil {
+				r.buffers[i] = r.ring.get()
+			} else {
+				r.buffers[i] = newReceiveBuffer(maxDatagramSize)
+			}
+		}
+	}
+
+	var used int
+	if r.batch != nil {
+		frames, used, err = r.batch.ReadFrames(r.buffers)
+	} else {
+		data := ReceivedData{buffer: r.buffers[0]}
+		var n int
+		if n, data.Remote, err = r.conn.ReadFrom(r.buffers[0].data); err == nil {
+			r.buffers[0].hold()
+			data.Data = r.buffers[0].data[:n]
+			r.frames[0] = data
+			frames, used = r.frames, 1
+		}
+	}
+
+	// the frames hold the references of the buffers
+	for i := 0; i < used; i++ {
+		r.buffers[i].release()
+		r.buffers[i] = nil
+	}
+	return
+}
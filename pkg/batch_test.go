@@ -0,0 +1,236 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchMessages(t *testing.T) {
+	frame := func(size int) []byte {
+		return make([]byte, size)
+	}
+	tests := []struct {
+		name       string
+		frames     [][]byte
+		gso        bool
+		wantCounts []int
+	}{{
+		name:       "without gso",
+		frames:     [][]byte{frame(10), frame(10), frame(10)},
+		wantCounts: []int{1, 1, 1},
+	}, {
+		name:       "same size",
+		frames:     [][]byte{frame(10), frame(10), frame(10)},
+		gso:        true,
+		wantCounts: []int{3},
+	}, {
+		name:       "the last one is shorter",
+		frames:     [][]byte{frame(10), frame(10), frame(5), frame(10)},
+		gso:        true,
+		wantCounts: []int{3, 1},
+	}, {
+		name:       "a larger one",
+		frames:     [][]byte{frame(10), frame(20), frame(20)},
+		gso:        true,
+		wantCounts: []int{1, 2},
+	}, {
+		name:       "over the max size",
+		frames:     [][]byte{frame(30000), frame(30000), frame(30000)},
+		gso:        true,
+		wantCounts: []int{2, 1},
+	}}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages, counts := batchMessages(tt.frames, tt.gso)
+			assert.Equal(t, tt.wantCounts, counts, "failed in case [%d]", i)
+			for j, message := range messages {
+				assert.Equal(t, counts[j], len(message.Buffers), "failed in case [%d]", i)
+				if tt.gso && counts[j] > 1 && batchSupported {
+					assert.NotEmpty(t, message.OOB, "failed in case [%d]", i)
+				} else {
+					assert.Empty(t, message.OOB, "failed in case [%d]", i)
+				}
+			}
+		})
+	}
+}
+
+func TestUDPTransportBatch(t *testing.T) {
+	for _, offload := range []bool{false, true} {
+		t.Run(fmt.Sprintf("offload %v", offload), func(t *testing.T) {
+			transport := &UDPTransport{Offload: offload}
+			server, err := transport.Listen("127.0.0.1:0")
+			assert.Nil(t, err)
+			defer func() {
+				_ = server.Close()
+			}()
+
+			client, err := transport.Dial(server.LocalAddr().String())
+			assert.Nil(t, err)
+			defer func() {
+				_ = client.Close()
+			}()
+
+			var frames [][]byte
+			for i := 0; i < 10; i++ {
+				frames = append(frames, bytes.Repeat([]byte{byte('a' + i)}, 1000))
+			}
+			// the last frame is shorter
+			frames = append(frames, []byte("hello"))
+
+			if writer, ok := client.(frameBatchWriter); ok {
+				n, err := writer.WriteFrames(frames)
+				assert.Nil(t, err)
+				assert.Equal(t, len(frames), n)
+			} else {
+				for _, frame := range frames {
+					_, err = client.Write(frame)
+					assert.Nil(t, err)
+				}
+			}
+
+			ring := newBufferRing(batchSize, maxDatagramSize)
+			reader := newFrameReader(server, ring)
+			var received [][]byte
+			_ = server.SetReadDeadline(time.Now().Add(time.Second))
+			for len(received) < len(frames) {
+				result, err := reader.read()
+				if !assert.Nil(t, err) {
+					return
+				}
+				for _, frame := range result {
+					received = append(received, append([]byte{}, frame.Data...))
+					frame.release()
+				}
+			}
+			assert.Equal(t, frames, received)
+			// only the buffers of the reader are in use
+			assert.LessOrEqual(t, ring.load(), 100)
+		})
+	}
+}
+
+func BenchmarkUDPWrite(b *testing.B) {
+	for _, mode := range []string{"single", "batch", "gso"} {
+		b.Run(mode, func(b *testing.B) {
+			server, err := net.ListenPacket("udp", "127.0.0.1:0")
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer func() {
+				_ = server.Close()
+			}()
+			go func() {
+				message := make([]byte, maxDatagramSize)
+				for {
+					if _, _, err := server.ReadFrom(message); err != nil {
+						return
+					}
+				}
+			}()
+
+			client, err := (&UDPTransport{Offload: mode == "gso"}).Dial(server.LocalAddr().String())
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer func() {
+				_ = client.Close()
+			}()
+			writer, ok := client.(frameBatchWriter)
+			if mode != "single" && !ok {
+				b.Skip("the batch syscalls are not supported")
+			}
+
+			frames := make([][]byte, batchSize)
+			for i := range frames {
+				frames[i] = make([]byte, 1200)
+			}
+
+			b.ResetTimer()
+			for sent := 0; sent < b.N; {
+				if mode == "single" {
+					_, err = client.Write(frames[0])
+					sent++
+				} else {
+					var n int
+					n, err = writer.WriteFrames(frames[:min(len(frames), b.N-sent)])
+					sent += n
+				}
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "packets/s")
+		})
+	}
+}
+
+func BenchmarkUDPRead(b *testing.B) {
+	for _, mode := range []string{"single", "batch", "gro"} {
+		b.Run(mode, func(b *testing.B) {
+			conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+			if err != nil {
+				b.Fatal(err)
+			}
+			var server net.PacketConn = conn
+			if mode != "single" {
+				server, _ = (&UDPTransport{Offload: mode == "gro"}).ListenPacket(conn)
+			}
+			defer func() {
+				_ = server.Close()
+			}()
+
+			client, err := (&UDPTransport{Offload: true}).Dial(server.LocalAddr().String())
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer func() {
+				_ = client.Close()
+			}()
+
+			frames := make([][]byte, batchSize)
+			for i := range frames {
+				frames[i] = make([]byte, 1200)
+			}
+			writer, _ := client.(frameBatchWriter)
+
+			reader := newFrameReader(server, newBufferRing(batchSize*2, maxDatagramSize))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for received := 0; received < b.N; {
+				// only the reading is measured, the datagrams of a batch fit the receive buffer
+				b.StopTimer()
+				if writer != nil {
+					_, err = writer.WriteFrames(frames)
+				} else {
+					for _, frame := range frames {
+						_, err = client.Write(frame)
+					}
+				}
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+
+				_ = server.SetReadDeadline(time.Now().Add(time.Second))
+				for count := 0; count < len(frames); {
+					result, err := reader.read()
+					if err != nil {
+						b.Fatal(err)
+					}
+					for _, frame := range result {
+						frame.release()
+					}
+					count += len(result)
+					received += len(result)
+				}
+			}
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "packets/s")
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package pkg
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// BenchmarkResult is the result of sending a file through a transport
+type BenchmarkResult struct {
+	Transport string
+	Loss      float64
+	Size      int64
+	Duration  time.Duration
+	Err       error
+}
+
+// Throughput returns the bytes per second
+func (r BenchmarkResult) Throughput() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Size) / r.Duration.Seconds()
+}
+
+// RunBenchmark sends the file over the loopback link through each transport,
+// the loss is the probability of dropping a packet in both directions of the waiter.
+// The stream transports, such as TCP, run without the loss as a reference.
+func RunBenchmark(file string, loss float64, transports ...string) (results []BenchmarkResult) {
+	for _, name := range transports {
+		result := BenchmarkResult{Transport: name, Loss: loss}
+		transport, err := NewTransport(name)
+		if err == nil {
+			if _, ok := transport.(packetListener); !ok {
+				result.Loss = 0
+			}
+			result.Size, result.Duration, err = benchmark(file, transport, result.Loss)
+		}
+		result.Err = err
+		results = append(results, result)
+	}
+	return
+}
+
+// benchmark sends the file through the transport, the duration is the one of sending it only
+func benchmark(file string, transport Transport, loss float64) (size int64, duration time.Duration, err error) {
+
+	var fi os.FileInfo
+	if fi, err = os.Stat(file); err != nil {
+		return
+	}
+	size = fi.Size()
+
+	var outputDir string
+	if outputDir, err = os.MkdirTemp("", "transfer-benchmark"); err != nil {
+		return
+	}
+	defer func() {
+		_ = os.RemoveAll(outputDir)
+	}()
+
+	var port int
+	if port, err = freePort(); err != nil {
+		return
+	}
+
+	waiterMsg := make(chan string, 10)
+	waiterErr := make(chan error, 1)
+	waiter := NewUDPWaiter(port).ListenAddress("127.0.0.1").
+		WithTransport(&lossyTransport{Transport: transport, loss: loss}).
+		WithOutputDir(outputDir)
+	go func() {
+		waiterErr <- waiter.Start(waiterMsg)
+	}()
+	// the first message means the waiter is listening
+	if _, ok := <-waiterMsg; !ok {
+		err = <-waiterErr
+		return
+	}
+	go func() {
+		for range waiterMsg {
+		}
+	}()
+
+	senderMsg := make(chan string, 10)
+	go func() {
+		for range senderMsg {
+		}
+	}()
+	sender := NewUDPSender("127.0.0.1").WithPort(port).WithTransport(transport)
+	begin := time.Now()
+	if err = sender.Send(senderMsg, file); err != nil {
+		return
+	}
+	duration = time.Since(begin)
+
+	if err = <-waiterErr; err == nil {
+		err = compareFiles(file, filepath.Join(outputDir, filepath.Base(file)))
+	}
+	return
+}
+
+func compareFiles(expected, actual string) (err error) {
+	var expectedSum, actualSum []byte
+	if expectedSum, err = fileChecksum(expected); err != nil {
+		return
+	}
+	if actualSum, err = fileChecksum(actual); err != nil {
+		return
+	}
+	if !bytes.Equal(expectedSum, actualSum) {
+		err = fmt.Errorf("the received file %s is different from %s", actual, expected)
+	}
+	return
+}
+
+func fileChecksum(file string) (sum []byte, err error) {
+	var f *os.File
+	if f, err = os.Open(file); err != nil {
+		return
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	hash := sha256.New()
+	if _, err = io.Copy(hash, f); err == nil {
+		sum = hash.Sum(nil)
+	}
+	return
+}
+
+func freePort() (port int, err error) {
+	var conn net.PacketConn
+	if conn, err = net.ListenPacket("udp", "127.0.0.1:0"); err != nil {
+		return
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	_, portText, _ := net.SplitHostPort(conn.LocalAddr().String())
+	port, err = strconv.Atoi(portText)
+	return
+}
+
+// lossyTransport drops the packets of the waiter with a probability
+type lossyTransport struct {
+	Transport
+	loss float64
+}
+
+// Listen listens to the frames over a lossy packet connection, a stream transport listens as it is without the loss
+func (t *lossyTransport) Listen(address string) (conn net.PacketConn, err error) {
+	listener, ok := t.Transport.(packetListener)
+	if !ok {
+		if t.loss > 0 {
+			err = fmt.Errorf("the transport %T does not support the emulated loss", t.Transport)
+		} else {
+			conn, err = t.Transport.Listen(address)
+		}
+		return
+	}
+
+	var packetConn net.PacketConn
+	if packetConn, err = net.ListenPacket("udp", address); err != nil {
+		return
+	}
+	// the sockets have the same buffers as the ones of the UDP transport, quic-go enlarges them further
+	lossy := &lossyPacketConn{PacketConn: packetConn, loss: t.loss}
+	setSocketBuffers(lossy)
+	if conn, err = listener.ListenPacket(lossy); err != nil {
+		_ = packetConn.Close()
+	}
+	return
+}
+
+// lossyPacketConn drops the incoming and outgoing packets with a probability
+type lossyPacketConn struct {
+	net.PacketConn
+	loss float64
+}
+
+// ReadFrom reads a packet which is not dropped
+func (c *lossyPacketConn) ReadFrom(p []byte) (n int, addr net.Addr, err error) {
+	for {
+		if n, addr, err = c.PacketConn.ReadFrom(p); err != nil || rand.Float64() >= c.loss {
+			return
+		}
+	}
+}
+
+// WriteTo writes a packet if it's not dropped
+func (c *lossyPacketConn) WriteTo(p []byte, addr net.Addr) (n int, err error) {
+	if rand.Float64() < c.loss {
+		return len(p), nil
+	}
+	return c.PacketConn.WriteTo(p, addr)
+}
+
+// SetReadBuffer sets the receive buffer size of the underlying connection, see setSocketBuffers
+func (c *lossyPacketConn) SetReadBuffer(bytes int) (err error) {
+	if conn, ok := c.PacketConn.(interface{ SetReadBuffer(int) error }); ok {
+		err = conn.SetReadBuffer(bytes)
+	}
+	return
+}
+
+// SetWriteBuffer sets the send buffer size of the underlying connection, see setSocketBuffers
+func (c *lossyPacketConn) SetWriteBuffer(bytes int) (err error) {
+	if conn, ok := c.PacketConn.(interface{ SetWriteBuffer(int) error }); ok {
+		err = conn.SetWriteBuffer(bytes)
+	}
+	return
+}
@@ -0,0 +1,77 @@
+package pkg
+
+import (
+	"net"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBenchmarkResult(t *testing.T) {
+	assert.Equal(t, float64(0), BenchmarkResult{Size: 100}.Throughput())
+	assert.Equal(t, float64(50), BenchmarkResult{Size: 100, Duration: 2 * time.Second}.Throughput())
+}
+
+func TestRunBenchmarkWithInvalidTransport(t *testing.T) {
+	file := path.Join(os.TempDir(), "fake-benchmark")
+	assert.Nil(t, os.WriteFile(file, []byte("hello"), 0600))
+	defer func() {
+		_ = os.RemoveAll(file)
+	}()
+
+	results := RunBenchmark(file, 0.1, "fake", TransportTCP)
+	if assert.Equal(t, 2, len(results)) {
+		assert.NotNil(t, results[0].Err)
+		// a stream transport runs without the emulated loss as a reference
+		assert.Nil(t, results[1].Err)
+		assert.Equal(t, float64(0), results[1].Loss)
+		assert.Equal(t, int64(5), results[1].Size)
+	}
+
+	_, err := (&lossyTransport{Transport: &TCPTransport{}, loss: 0.1}).Listen("127.0.0.1:0")
+	assert.NotNil(t, err)
+}
+
+func TestLossyPacketConn(t *testing.T) {
+	tests := []struct {
+		name     string
+		loss     float64
+		received bool
+	}{{
+		name:     "no loss",
+		loss:     0,
+		received: true,
+	}, {
+		name: "lose all",
+		loss: 1,
+	}}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := net.ListenPacket("udp", "127.0.0.1:0")
+			assert.Nil(t, err)
+			conn := &lossyPacketConn{PacketConn: server, loss: tt.loss}
+			defer func() {
+				_ = conn.Close()
+			}()
+			// the buffers of the underlying socket are set through it
+			assert.Nil(t, conn.SetReadBuffer(socketBufferSize), "failed in case [%d]", i)
+			assert.Nil(t, conn.SetWriteBuffer(socketBufferSize), "failed in case [%d]", i)
+
+			client, err := net.Dial("udp", server.LocalAddr().String())
+			assert.Nil(t, err)
+			_, err = client.Write([]byte("hello"))
+			assert.Nil(t, err)
+
+			_ = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			_, _, err = conn.ReadFrom(make([]byte, 10))
+			assert.Equal(t, tt.received, err == nil, "failed in case [%d]", i)
+
+			n, err := conn.WriteTo([]byte("hello"), client.LocalAddr())
+			assert.Nil(t, err, "failed in case [%d]", i)
+			assert.Equal(t, 5, n, "failed in case [%d]", i)
+		})
+	}
+}
@@ -2,61 +2,231 @@ package pkg
 
 import (
 	"context"
+	"fmt"
 	"net"
+	"strconv"
 	"time"
 )
 
-// Broadcast sends the broadcast message to all the potential ip addresses
-func Broadcast(ctx context.Context) (err error) {
+// DiscoveryGroupIPv6 is the link-local multicast group for the networks which have no IPv4 broadcast domain
+var DiscoveryGroupIPv6 = net.ParseIP("ff02::7472")
+
+// Broadcaster sends the announcement of a peer to the potential waiter finders
+type Broadcaster struct {
+	peer      Peer
+	port      int
+	targets   []string
+	interval  time.Duration
+	outputDir string
+}
+
+// NewBroadcaster creates an instance of Broadcaster
+func NewBroadcaster(peer Peer) *Broadcaster {
+	return &Broadcaster{
+		peer:      peer,
+		port:      DefaultDiscoveryPort,
+		interval:  3 * time.Second,
+		outputDir: ".",
+	}
+}
+
+// WithTargets sets the extra broadcast addresses, such as the limited broadcast address 255.255.255.255
+func (b *Broadcaster) WithTargets(targets ...string) *Broadcaster {
+	b.targets = append(b.targets, targets...)
+	return b
+}
+
+// WithPort sets the port of the announcements, the senders should listen to the same one
+func (b *Broadcaster) WithPort(port int) *Broadcaster {
+	if port > 0 {
+		b.port = port
+	}
+	return b
+}
+
+// WithOutputDir sets the directory which the waiter writes the files into, the free space is measured on it
+func (b *Broadcaster) WithOutputDir(dir string) *Broadcaster {
+	if dir != "" {
+		b.outputDir = dir
+	}
+	return b
+}
+
+// Broadcast sends the announcement of the peer to all the potential ip addresses
+func Broadcast(ctx context.Context, peer Peer) (err error) {
+	return NewBroadcaster(peer).Start(ctx)
+}
+
+// Start sends the announcement to the broadcast address of each interface until the context is done
+func (b *Broadcaster) Start(ctx context.Context) (err error) {
+	var targets []*net.UDPAddr
+	for _, target := range b.targets {
+		var addr *net.UDPAddr
+		if addr, err = net.ResolveUDPAddr("udp", net.JoinHostPort(target, strconv.Itoa(b.port))); err != nil {
+			err = fmt.Errorf("invalid broadcast address: '%s', %v", target, err)
+			return
+		}
+		targets = append(targets, addr)
+	}
+
 	var ifaces []net.Interface
 	if ifaces, err = net.Interfaces(); err != nil {
 		return
 	}
 
-	var addrs []net.Addr
-	var allIPs []net.IP
+	var announcers []*announcer
 	for _, i := range ifaces {
-		if addrs, err = i.Addrs(); err != nil {
-			continue
+		if a := newInterfaceAnnouncer(i, b.port); a != nil {
+			announcers = append(announcers, a)
+		} else if a = newMulticastAnnouncer(i, b.port); a != nil {
+			announcers = append(announcers, a)
 		}
+	}
 
-		for _, addr := range addrs {
-			var ip net.IP
-			switch v := addr.(type) {
-			case *net.IPNet:
-				ip = v.IP
-			}
-
-			if ip == nil || ip.IsLinkLocalUnicast() || ip.IsLoopback() || ip.To4() == nil {
-				continue
-			}
-
-			allIPs = append(allIPs, ip)
+	if len(targets) > 0 {
+		var conn *net.UDPConn
+		if conn, err = net.ListenUDP("udp", &net.UDPAddr{}); err != nil {
+			closeAnnouncers(announcers)
+			return
 		}
+		announcers = append(announcers, &announcer{conn: conn, targets: targets})
 	}
 
-	for _, ip := range allIPs {
-		go func(ctx context.Context, ip net.IP) {
-			broadcast(ctx, ip)
-		}(ctx, ip)
-	}
+	go b.broadcast(ctx, announcers)
 	return
 }
 
-func broadcast(ctx context.Context, ip net.IP) {
+func (b *Broadcaster) broadcast(ctx context.Context, announcers []*announcer) {
+	defer closeAnnouncers(announcers)
+
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
 	for {
+		// the free space might change between the announcements
+		peer := b.peer
+		peer.FreeSpace, _ = FreeSpace(b.outputDir)
+		if data, err := peer.Marshal(); err == nil {
+			for _, a := range announcers {
+				a.send(data)
+			}
+		}
+
 		select {
 		case <-ctx.Done():
 			return
-		case <-time.After(3 * time.Second):
-			ip.To4()[3] = 255
-			srcAddr := &net.UDPAddr{IP: net.IPv4zero, Port: 0}
-			dstAddr := &net.UDPAddr{IP: ip, Port: 9981}
-			conn, err := net.ListenUDP("udp", srcAddr)
-			if err != nil {
-				return
-			}
-			_, _ = conn.WriteToUDP([]byte("hello"), dstAddr)
+		case <-ticker.C:
+		}
+	}
+}
+
+// announcer holds the socket of an interface, and the broadcast addresses of it
+type announcer struct {
+	conn    *net.UDPConn
+	targets []*net.UDPAddr
+}
+
+func newInterfaceAnnouncer(iface net.Interface, port int) (a *announcer) {
+	if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+		return
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return
+	}
+
+	var source net.IP
+	var targets []*net.UDPAddr
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.To4() == nil || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+
+		if source == nil {
+			source = ipNet.IP
 		}
+		target := broadcastAddress(ipNet)
+		if target == nil || iface.Flags&net.FlagBroadcast == 0 {
+			// there is no broadcast address of a point-to-point link, or /31 and /32 networks
+			target = net.IPv4bcast
+		}
+		targets = append(targets, &net.UDPAddr{IP: target, Port: port})
+	}
+
+	if source == nil {
+		return
+	}
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: source})
+	if err != nil {
+		return
 	}
+	a = &announcer{conn: conn, targets: targets}
+	return
+}
+
+// newMulticastAnnouncer creates the announcer which sends to the IPv6 link-local multicast group
+func newMulticastAnnouncer(iface net.Interface, port int) (a *announcer) {
+	if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 || iface.Flags&net.FlagMulticast == 0 {
+		return
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return
+	}
+
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.To4() != nil || !ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+
+		var conn *net.UDPConn
+		if conn, err = net.ListenUDP("udp6", &net.UDPAddr{IP: ipNet.IP, Zone: iface.Name}); err != nil {
+			continue
+		}
+		a = &announcer{
+			conn:    conn,
+			targets: []*net.UDPAddr{{IP: DiscoveryGroupIPv6, Port: port, Zone: iface.Name}},
+		}
+		return
+	}
+	return
+}
+
+func (a *announcer) send(data []byte) {
+	for _, target := range a.targets {
+		_, _ = a.conn.WriteToUDP(data, target)
+	}
+}
+
+func closeAnnouncers(announcers []*announcer) {
+	for _, a := range announcers {
+		_ = a.conn.Close()
+	}
+}
+
+// broadcastAddress returns the directed broadcast address of an IPv4 network,
+// returns nil if it's not an IPv4 network or there's no broadcast address in it
+func broadcastAddress(ipNet *net.IPNet) (ip net.IP) {
+	ipv4 := ipNet.IP.To4()
+	if ipv4 == nil {
+		return
+	}
+
+	mask := ipNet.Mask
+	if len(mask) == net.IPv6len {
+		mask = mask[12:]
+	}
+	if ones, bits := mask.Size(); bits != 8*net.IPv4len || ones >= 31 {
+		return
+	}
+
+	ip = make(net.IP, net.IPv4len)
+	for i := range ipv4 {
+		ip[i] = ipv4[i] | ^mask[i]
+	}
+	return
 }
@@ -0,0 +1,108 @@
+package pkg
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBroadcastAddress(t *testing.T) {
+	tests := []struct {
+		name string
+		cidr string
+		want string
+	}{{
+		name: "class C",
+		cidr: "192.168.1.10/24",
+		want: "192.168.1.255",
+	}, {
+		name: "class B",
+		cidr: "172.16.3.4/16",
+		want: "172.16.255.255",
+	}, {
+		name: "22 bits mask",
+		cidr: "10.0.5.6/22",
+		want: "10.0.7.255",
+	}, {
+		name: "25 bits mask",
+		cidr: "192.168.1.10/25",
+		want: "192.168.1.127",
+	}, {
+		name: "upper half of 25 bits mask",
+		cidr: "192.168.1.200/25",
+		want: "192.168.1.255",
+	}, {
+		name: "point-to-point network",
+		cidr: "192.168.1.10/31",
+	}, {
+		name: "single host",
+		cidr: "192.168.1.10/32",
+	}, {
+		name: "IPv6",
+		cidr: "fd00::1/64",
+	}}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip, ipNet, err := net.ParseCIDR(tt.cidr)
+			assert.Nil(t, err)
+			ipNet.IP = ip
+
+			result := broadcastAddress(ipNet)
+			if tt.want == "" {
+				assert.Nil(t, result, "failed in case [%d]", i)
+			} else {
+				assert.Equal(t, tt.want, result.String(), "failed in case [%d]", i)
+			}
+			// the interface address should not be changed
+			assert.Equal(t, ip, ipNet.IP, "failed in case [%d]", i)
+		})
+	}
+}
+
+func TestBroadcasterWithInvalidTarget(t *testing.T) {
+	err := NewBroadcaster(Peer{}).WithTargets("invalid").Start(context.TODO())
+	assert.NotNil(t, err)
+}
+
+func TestBroadcasterWithOutputDir(t *testing.T) {
+	assert.Equal(t, ".", NewBroadcaster(Peer{}).WithOutputDir("").outputDir)
+	assert.Equal(t, "/data", NewBroadcaster(Peer{}).WithOutputDir("/data").outputDir)
+}
+
+func TestDiscoveryGroup(t *testing.T) {
+	tests := []struct {
+		group string
+		want  []string
+	}{{
+		group: "team-a",
+		want:  []string{"a"},
+	}, {
+		group: "",
+		want:  []string{"default"},
+	}, {
+		group: "team-c",
+	}}
+	for i, tt := range tests {
+		ctx, cancel := context.WithCancel(context.TODO())
+		port, err := freePort()
+		assert.Nil(t, err, "failed in case [%d]", i)
+		for _, peer := range []Peer{{Name: "a", Port: 3001, Group: "team-a"}, {Name: "b", Port: 3002, Group: "team-b"}, {Name: "default", Port: 3003}} {
+			broadcaster := NewBroadcaster(peer).WithPort(port).WithTargets("127.0.0.1")
+			broadcaster.interval = 100 * time.Millisecond
+			assert.Nil(t, broadcaster.Start(ctx), "failed in case [%d]", i)
+		}
+
+		// the announcement might come from multiple addresses of this machine
+		var names []string
+		for _, peer := range (Discovery{Port: port, Group: tt.group}).DiscoverPeers(ctx, time.Second).List() {
+			if len(names) == 0 || names[len(names)-1] != peer.Name {
+				names = append(names, peer.Name)
+			}
+		}
+		assert.Equal(t, tt.want, names, "failed in case [%d]", i)
+		cancel()
+	}
+}
@@ -0,0 +1,80 @@
+package pkg
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// bufferRing is a fixed count of the receive buffers, they are allocated once and reused.
+// Getting a buffer blocks if all of them are in use, so the memory is bounded.
+type bufferRing struct {
+	free  chan *receiveBuffer
+	count int
+	size  int
+
+	lock    sync.Mutex
+	created int
+	inUse   atomic.Int32
+}
+
+// receiveBuffer is shared by the frames which were read into it, it goes back to the ring once all of them were released
+type receiveBuffer struct {
+	data []byte
+	refs atomic.Int32
+	ring *bufferRing
+}
+
+func newBufferRing(count, size int) *bufferRing {
+	return &bufferRing{
+		free:  make(chan *receiveBuffer, count),
+		count: count,
+		size:  size,
+	}
+}
+
+// get takes a free buffer, a new one is created if there are less buffers than the count
+func (r *bufferRing) get() (buf *receiveBuffer) {
+	select {
+	case buf = <-r.free:
+	default:
+		r.lock.Lock()
+		if r.created < r.count {
+			r.created++
+			buf = &receiveBuffer{data: make([]byte, r.size), ring: r}
+		}
+		r.lock.Unlock()
+
+		if buf == nil {
+			buf = <-r.free
+		}
+	}
+	buf.refs.Store(1)
+	r.inUse.Add(1)
+	return
+}
+
+// load returns the percentage of the buffers which are in use
+func (r *bufferRing) load() int {
+	return int(r.inUse.Load()) * 100 / r.count
+}
+
+// newReceiveBuffer creates a buffer which does not belong to a ring
+func newReceiveBuffer(size int) *receiveBuffer {
+	return &receiveBuffer{data: make([]byte, size)}
+}
+
+// hold adds a reference of the buffer
+func (b *receiveBuffer) hold() {
+	b.refs.Add(1)
+}
+
+// release puts the buffer back to the ring if there is no reference
+func (b *receiveBuffer) release() {
+	if b == nil || b.ring == nil {
+		return
+	}
+	if b.refs.Add(-1) == 0 {
+		b.ring.inUse.Add(-1)
+		b.ring.free <- b
+	}
+}
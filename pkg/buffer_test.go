@@ -0,0 +1,48 @@
+package pkg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBufferRing(t *testing.T) {
+	ring := newBufferRing(2, 10)
+	first := ring.get()
+	assert.Equal(t, 10, len(first.data))
+	assert.Equal(t, 50, ring.load())
+
+	// the buffer is shared by two frames
+	second := ring.get()
+	second.hold()
+	assert.Equal(t, 100, ring.load())
+	second.release()
+	assert.Equal(t, 100, ring.load())
+
+	// all the buffers are in use
+	got := make(chan *receiveBuffer)
+	go func() {
+		got <- ring.get()
+	}()
+	select {
+	case <-got:
+		assert.Fail(t, "should wait for a free buffer")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	second.release()
+	select {
+	case buf := <-got:
+		assert.Same(t, second, buf)
+	case <-time.After(time.Second):
+		assert.Fail(t, "should get the released buffer")
+	}
+
+	// the buffer which does not belong to a ring
+	newReceiveBuffer(10).release()
+	var empty *receiveBuffer
+	empty.release()
+	first.release()
+	assert.Equal(t, 50, ring.load())
+}
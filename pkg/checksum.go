@@ -0,0 +1,42 @@
+package pkg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+)
+
+// checksumLength is the length of a checksum in the frames, it's the hex string of a SHA-256
+const checksumLength = sha256.Size * 2
+
+// checksum returns the SHA-256 of the data, it's a hex string
+func checksum(reader io.ReaderAt, size int64) (sum string, err error) {
+	hash := sha256.New()
+	if _, err = io.Copy(hash, io.NewSectionReader(reader, 0, size)); err == nil {
+		sum = hex.EncodeToString(hash.Sum(nil))
+	}
+	return
+}
+
+// sourceChecksum is the checksum of the data to send, it's calculated in the background while sending
+type sourceChecksum struct {
+	done chan struct{}
+	sum  string
+	err  error
+}
+
+// newSourceChecksum starts to calculate the checksum
+func newSourceChecksum(reader io.ReaderAt, size int64) *sourceChecksum {
+	c := &sourceChecksum{done: make(chan struct{})}
+	go func() {
+		defer close(c.done)
+		c.sum, c.err = checksum(reader, size)
+	}()
+	return c
+}
+
+// wait returns the checksum once it's calculated
+func (c *sourceChecksum) wait() (sum string, err error) {
+	<-c.done
+	return c.sum, c.err
+}
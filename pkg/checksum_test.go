@@ -0,0 +1,32 @@
+package pkg
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecksum(t *testing.T) {
+	data := strings.NewReader("hello")
+	sum, err := checksum(data, data.Size())
+	assert.Nil(t, err)
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", sum)
+	assert.Len(t, sum, checksumLength)
+
+	// the checksum is the same if it's calculated in the background
+	result, err := newSourceChecksum(data, data.Size()).wait()
+	assert.Nil(t, err)
+	assert.Equal(t, sum, result)
+
+	_, err = newSourceChecksum(&fakeReaderAt{}, 10).wait()
+	assert.NotNil(t, err)
+}
+
+// fakeReaderAt always fails to read
+type fakeReaderAt struct{}
+
+func (r *fakeReaderAt) ReadAt([]byte, int64) (int, error) {
+	return 0, errors.New("fake")
+}
@@ -0,0 +1,71 @@
+// Package pkg sends and receives the files over UDP, TCP or QUIC, it's the library of the transfer command.
+// Embed it in a Go service with Client and Server, they are compatible with the send and wait commands.
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+)
+
+// Metadata describes the data of a session
+type Metadata struct {
+	// Name is the file name, the server gets the base name only
+	Name string
+}
+
+// Client sends the data to a Server, or to a waiter of the transfer command.
+// Each Send is a session, they could run at the same time if the server listens to different ports.
+type Client struct {
+	ip      string
+	port    int
+	options options
+}
+
+// NewClient creates a client which sends to the address, such as: 192.168.1.2:3000
+func NewClient(address string, opts ...Option) (client *Client, err error) {
+	var ip string
+	var port int
+	if ip, port, err = splitAddress(address); err == nil {
+		client = &Client{ip: ip, port: port, options: newOptions(opts)}
+	}
+	return
+}
+
+// Send sends the data of the reader until the server acknowledged it, the chunks are read at their offsets.
+// It returns ErrCancelled once the context is done, the summary has the error as well.
+func (c *Client) Send(ctx context.Context, reader io.ReaderAt, size int64, metadata Metadata) (summary Summary, err error) {
+	if metadata.Name == "" {
+		err = fmt.Errorf("the name of the data is required")
+		summary.Error = err.Error()
+		return
+	}
+
+	msg := make(chan string, 10)
+	go func() {
+		// there is nobody to print the messages
+		for range msg {
+		}
+	}()
+
+	sender := c.options.sender(c.ip, c.port).WithContext(ctx)
+	err = sender.SendReader(msg, metadata.Name, reader, size)
+	if summary = sender.Summary(); err != nil {
+		summary.Error = err.Error()
+	}
+	return
+}
+
+// splitAddress splits an address into the host and the port, such as: 192.168.1.2:3000
+func splitAddress(address string) (host string, port int, err error) {
+	var portText string
+	if host, portText, err = net.SplitHostPort(address); err != nil {
+		return
+	}
+	if port, err = strconv.Atoi(portText); err != nil || port <= 0 || port > 65535 {
+		err = fmt.Errorf("invalid port in address '%s'", address)
+	}
+	return
+}
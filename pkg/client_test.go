@@ -0,0 +1,54 @@
+package pkg
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientSendWithoutName(t *testing.T) {
+	client, err := NewClient("127.0.0.1:3000")
+	assert.Nil(t, err)
+	summary, err := client.Send(context.Background(), strings.NewReader("hello"), 5, Metadata{})
+	assert.NotNil(t, err)
+	assert.Equal(t, err.Error(), summary.Error)
+}
+
+func TestSplitAddress(t *testing.T) {
+	tests := []struct {
+		address  string
+		wantHost string
+		wantPort int
+		wantErr  bool
+	}{{
+		address:  "192.168.1.2:3000",
+		wantHost: "192.168.1.2",
+		wantPort: 3000,
+	}, {
+		address:  ":3000",
+		wantPort: 3000,
+	}, {
+		address:  "[::1]:3000",
+		wantHost: "::1",
+		wantPort: 3000,
+	}, {
+		address: "192.168.1.2",
+		wantErr: true,
+	}, {
+		address: "192.168.1.2:port",
+		wantErr: true,
+	}, {
+		address: "192.168.1.2:70000",
+		wantErr: true,
+	}}
+	for i, tt := range tests {
+		host, port, err := splitAddress(tt.address)
+		assert.Equal(t, tt.wantErr, err != nil, "failed in case [%d]", i)
+		if !tt.wantErr {
+			assert.Equal(t, tt.wantHost, host, "failed in case [%d]", i)
+			assert.Equal(t, tt.wantPort, port, "failed in case [%d]", i)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package pkg
 
 import (
+	"crypto/rand"
 	"fmt"
+	"math/big"
 	"strings"
 	"time"
 )
@@ -37,3 +39,17 @@ func fillContainer(txt string, size int) string {
 	buf.WriteString(txt)
 	return buf.String()
 }
+
+// RandomCode returns a random code which is easy to read and type
+func RandomCode(length int) string {
+	const letters = "abcdefghjkmnpqrstuvwxyz23456789"
+	buf := strings.Builder{}
+	for i := 0; i < length; i++ {
+		index, err := rand.Int(rand.Reader, big.NewInt(int64(len(letters))))
+		if err != nil {
+			index = big.NewInt(int64(time.Now().UnixNano() % int64(len(letters))))
+		}
+		buf.WriteByte(letters[index.Int64()])
+	}
+	return buf.String()
+}
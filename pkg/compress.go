@@ -0,0 +1,123 @@
+package pkg
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+// the supported compression algorithms
+const (
+	CompressZstd = "zstd"
+	CompressLZ4  = "lz4"
+)
+
+// the codec letters in the chunk header
+const (
+	codecZstd byte = 'z'
+	codecLZ4  byte = 'l'
+)
+
+const (
+	// compressRatio is the max ratio of the compressed size, the chunk is sent as is if it's not small enough
+	compressRatio = 0.9
+	// sampleCount is the count of the first chunks which are always compressed
+	sampleCount = 8
+	// sampleInterval is the interval of the chunks which are compressed even if the compression was turned off
+	sampleInterval = 64
+)
+
+// compressor compresses the chunks, and turns off the compression if the sampled chunks are not compressible
+type compressor struct {
+	codec   byte
+	encoder *zstd.Encoder
+	pool    sync.Pool
+	enabled atomic.Bool
+}
+
+func newCompressor(name string) (c *compressor, err error) {
+	c = &compressor{}
+	switch name {
+	case CompressZstd:
+		c.codec = codecZstd
+		c.encoder, err = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest))
+	case CompressLZ4:
+		c.codec = codecLZ4
+	default:
+		err = fmt.Errorf("unsupported compression: '%s', should be one of %s, %s", name, CompressZstd, CompressLZ4)
+	}
+	c.enabled.Store(true)
+	return
+}
+
+// compress compresses the data in place, returns the new size and the codec.
+// The data is not changed and the codec is zero if it's not compressed.
+func (c *compressor) compress(index int, data []byte) (n int, codec byte) {
+	n = len(data)
+	sampled := index < sampleCount || index%sampleInterval == 0
+	if !sampled && !c.enabled.Load() {
+		return
+	}
+
+	buf, _ := c.pool.Get().(*[]byte)
+	if buf == nil {
+		buf = new([]byte)
+	}
+	defer c.pool.Put(buf)
+
+	var compressed []byte
+	switch c.codec {
+	case codecZstd:
+		compressed = c.encoder.EncodeAll(data, (*buf)[:0])
+	case codecLZ4:
+		if bound := lz4.CompressBlockBound(len(data)); cap(*buf) < bound {
+			*buf = make([]byte, bound)
+		}
+		size, err := lz4.CompressBlock(data, (*buf)[:cap(*buf)], nil)
+		if err != nil || size == 0 {
+			// zero means the data is not compressible
+			size = len(data)
+		}
+		compressed = (*buf)[:size]
+	}
+	*buf = compressed[:0]
+
+	worthy := float64(len(compressed)) < float64(len(data))*compressRatio
+	if sampled {
+		c.enabled.Store(worthy)
+	}
+	if worthy {
+		n, codec = copy(data, compressed), c.codec
+	}
+	return
+}
+
+var (
+	decoder     *zstd.Decoder
+	decoderOnce sync.Once
+)
+
+// decompress decompresses the data of a chunk into the buffer, the result should not be longer than the buffer
+func decompress(codec byte, data, buf []byte) (result []byte, err error) {
+	switch codec {
+	case codecZstd:
+		decoderOnce.Do(func() {
+			decoder, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0),
+				zstd.WithDecoderMaxMemory(maxDatagramSize))
+		})
+		if result, err = decoder.DecodeAll(data, buf[:0]); err == nil && len(result) > len(buf) {
+			err = fmt.Errorf("the decompressed chunk is larger than %d", len(buf))
+		}
+	case codecLZ4:
+		var n int
+		if n, err = lz4.UncompressBlock(data, buf); err == nil {
+			result = buf[:n]
+		}
+	default:
+		err = fmt.Errorf("unknown codec '%c'", codec)
+	}
+	return
+}
@@ -0,0 +1,94 @@
+package pkg
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressor(t *testing.T) {
+	random := make([]byte, 60000)
+	_, _ = rand.Read(random)
+
+	tests := []struct {
+		name      string
+		compress  string
+		data      []byte
+		wantCodec byte
+	}{{
+		name:      "zstd",
+		compress:  CompressZstd,
+		data:      bytes.Repeat([]byte("hello world\n"), 5000),
+		wantCodec: codecZstd,
+	}, {
+		name:      "lz4",
+		compress:  CompressLZ4,
+		data:      bytes.Repeat([]byte("hello world\n"), 5000),
+		wantCodec: codecLZ4,
+	}, {
+		name:     "incompressible with zstd",
+		compress: CompressZstd,
+		data:     random,
+	}, {
+		name:     "incompressible with lz4",
+		compress: CompressLZ4,
+		data:     random,
+	}}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := newCompressor(tt.compress)
+			if !assert.Nil(t, err, "failed in case [%d]", i) {
+				return
+			}
+
+			data := append([]byte{}, tt.data...)
+			n, codec := c.compress(0, data)
+			assert.Equal(t, tt.wantCodec, codec, "failed in case [%d]", i)
+			if codec == 0 {
+				assert.Equal(t, len(tt.data), n, "failed in case [%d]", i)
+				assert.Equal(t, tt.data, data, "failed in case [%d]", i)
+				return
+			}
+			assert.Less(t, n, len(tt.data), "failed in case [%d]", i)
+
+			result, err := decompress(codec, data[:n], make([]byte, len(tt.data)))
+			assert.Nil(t, err, "failed in case [%d]", i)
+			assert.Equal(t, tt.data, result, "failed in case [%d]", i)
+
+			// the buffer is not big enough
+			_, err = decompress(codec, data[:n], make([]byte, 10))
+			assert.NotNil(t, err, "failed in case [%d]", i)
+		})
+	}
+}
+
+func TestCompressorAutoSkip(t *testing.T) {
+	c, err := newCompressor(CompressZstd)
+	assert.Nil(t, err)
+
+	random := make([]byte, 1000)
+	_, _ = rand.Read(random)
+	text := bytes.Repeat([]byte("a"), 1000)
+
+	// the sampled chunk turns off the compression
+	_, codec := c.compress(0, append([]byte{}, random...))
+	assert.Equal(t, byte(0), codec)
+	_, codec = c.compress(sampleCount+1, append([]byte{}, text...))
+	assert.Equal(t, byte(0), codec, "should not compress when it's turned off")
+
+	// turn it on again by a sampled chunk
+	_, codec = c.compress(sampleInterval, append([]byte{}, text...))
+	assert.Equal(t, codecZstd, codec)
+	_, codec = c.compress(sampleInterval+1, append([]byte{}, text...))
+	assert.Equal(t, codecZstd, codec)
+}
+
+func TestNewCompressorWithUnknown(t *testing.T) {
+	_, err := newCompressor("fake")
+	assert.NotNil(t, err)
+
+	_, err = decompress('x', nil, nil)
+	assert.NotNil(t, err)
+}
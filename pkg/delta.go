@@ -0,0 +1,201 @@
+package pkg
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the codec letters of the delta sync in the chunk header
+const (
+	// codecSums asks the waiter for the block sums of the existing file
+	codecSums byte = 's'
+	// codecCopy tells the waiter to copy a block of the existing file, the data is the source index
+	codecCopy byte = 'c'
+)
+
+const (
+	// sumsPrefix is the prefix of the frames which carry the block sums,
+	// the format is: sums + session + start index (10) + total count (10) + sums
+	sumsPrefix = "sums"
+	// sumsPerFrame is the count of the block sums in one frame
+	sumsPerFrame = 1024
+	// sumsHeaderLength is the length of the prefix, session, start index and total count
+	sumsHeaderLength = len(sumsPrefix) + sessionIDLength + 20
+	// deltaTimeout is the duration of waiting for the block sums
+	deltaTimeout = time.Minute
+	// deltaSuffix is the suffix of the temporary file which is written in the delta sync
+	deltaSuffix = ".transfer"
+)
+
+// blockSum is the strong hash of a block
+type blockSum [sha256.Size]byte
+
+// blockSums calculates the sums of the blocks, the blocks have the same size as the chunks
+func blockSums(reader io.ReaderAt, size int64, chunk int) (sums []blockSum, err error) {
+	buf := make([]byte, chunk)
+	for offset := int64(0); offset < size; offset += int64(chunk) {
+		var n int
+		if n, err = reader.ReadAt(buf, offset); err != nil && !(errors.Is(err, io.EOF) && n > 0) {
+			return
+		}
+		err = nil
+		sums = append(sums, sha256.Sum256(buf[:n]))
+	}
+	return
+}
+
+// sumsFrames encodes the sums into frames
+func sumsFrames(sums []blockSum, session string) (frames [][]byte) {
+	for start := 0; start == 0 || start < len(sums); start += sumsPerFrame {
+		end := start + sumsPerFrame
+		if end > len(sums) {
+			end = len(sums)
+		}
+
+		frame := bytes.NewBufferString(sumsPrefix + fillContainer(session, sessionIDLength) +
+			fillContainerWithNumber(start, 10) + fillContainerWithNumber(len(sums), 10))
+		for _, sum := range sums[start:end] {
+			frame.Write(sum[:])
+		}
+		frames = append(frames, frame.Bytes())
+	}
+	return
+}
+
+// sumsFrameCount returns the count of the frames of the sums, there is one frame at least
+func sumsFrameCount(total int) int {
+	if total == 0 {
+		return 1
+	}
+	return (total + sumsPerFrame - 1) / sumsPerFrame
+}
+
+// parseSumsFrame decodes a frame of the sums, it's not ok if the frame belongs to another session
+func parseSumsFrame(frame []byte, session string) (start, total int, sums []blockSum, ok bool) {
+	prefix := sumsPrefix + fillContainer(session, sessionIDLength)
+	if len(frame) < sumsHeaderLength || !bytes.HasPrefix(frame, []byte(prefix)) ||
+		(len(frame)-sumsHeaderLength)%sha256.Size != 0 {
+		return
+	}
+
+	var err error
+	if start, err = strconv.Atoi(strings.TrimSpace(string(frame[len(prefix) : len(prefix)+10]))); err != nil {
+		return
+	}
+	if total, err = strconv.Atoi(strings.TrimSpace(string(frame[len(prefix)+10 : sumsHeaderLength]))); err != nil {
+		return
+	}
+	for data := frame[sumsHeaderLength:]; len(data) > 0; data = data[sha256.Size:] {
+		var sum blockSum
+		copy(sum[:], data)
+		sums = append(sums, sum)
+	}
+	ok = start+len(sums) <= total
+	return
+}
+
+// requestSums asks the waiter for the block sums of its existing file, it's empty if there is no such file
+func requestSums(conn net.Conn, builder *HeaderBuilder, timeout time.Duration) (sums []blockSum, err error) {
+	defer func() {
+		_ = conn.SetReadDeadline(time.Time{})
+	}()
+
+	request := append([]byte(builder.headerWithCodec(0, codecSums)), '?')
+	message := make([]byte, maxDatagramSize)
+	received := map[int]bool{}
+	total := -1
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); {
+		if _, err = conn.Write(request); err != nil {
+			time.Sleep(time.Second)
+			continue
+		}
+
+		// the frames of the sums might be lost, ask for all of them again if it times out
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		for {
+			n, readErr := conn.Read(message)
+			if readErr != nil {
+				break
+			}
+			start, count, frameSums, ok := parseSumsFrame(message[:n], builder.session)
+			if !ok {
+				continue
+			}
+			if total != count {
+				total, sums, received = count, make([]blockSum, count), map[int]bool{}
+			}
+			copy(sums[start:], frameSums)
+			received[start] = true
+			if len(received) == sumsFrameCount(total) {
+				err = nil
+				return
+			}
+		}
+	}
+	err = fmt.Errorf("%w: no block sums from the waiter in %v", ErrTimeout, timeout)
+	return
+}
+
+// planCopies finds the chunks which the waiter already has, the key is the index of the chunk,
+// the value is the index of the same block in the existing file of the waiter.
+// The blocks are aligned to the chunks, a block which is shifted by the inserted or deleted bytes does not match.
+func planCopies(reader io.ReaderAt, builder *HeaderBuilder, sums []blockSum) (copies map[int]int, err error) {
+	copies = map[int]int{}
+	if len(sums) == 0 {
+		return
+	}
+
+	blocks := make(map[blockSum]int, len(sums))
+	for i := len(sums) - 1; i >= 0; i-- {
+		blocks[sums[i]] = i
+	}
+
+	var local []blockSum
+	if local, err = blockSums(reader, builder.GetFileSize(), builder.GetChunk()); err != nil {
+		return
+	}
+	for i, sum := range local {
+		if i < len(sums) && sums[i] == sum {
+			// prefer the block at the same position
+			copies[i] = i
+		} else if j, ok := blocks[sum]; ok {
+			copies[i] = j
+		}
+	}
+	return
+}
+
+// replySums sends the block sums of the existing file to the sender
+func replySums(conn net.PacketConn, remote net.Addr, sums []blockSum, session string) {
+	for _, frame := range sumsFrames(sums, session) {
+		_, _ = conn.WriteTo(frame, remote)
+	}
+}
+
+// existingSums calculates the block sums of the existing file, it's nil if there is no such file
+func existingSums(file string, chunk int) (original *os.File, sums []blockSum, err error) {
+	if original, err = os.Open(file); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			err = nil
+		}
+		return
+	}
+
+	var fi os.FileInfo
+	if fi, err = original.Stat(); err == nil {
+		sums, err = blockSums(original, fi.Size(), chunk)
+	}
+	if err != nil {
+		_ = original.Close()
+		original = nil
+	}
+	return
+}
@@ -0,0 +1,128 @@
+package pkg
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSumsFrames(t *testing.T) {
+	tests := []struct {
+		name       string
+		count      int
+		wantFrames int
+	}{{
+		name:       "empty",
+		count:      0,
+		wantFrames: 1,
+	}, {
+		name:       "one frame",
+		count:      10,
+		wantFrames: 1,
+	}, {
+		name:       "multiple frames",
+		count:      sumsPerFrame*2 + 1,
+		wantFrames: 3,
+	}}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sums := make([]blockSum, tt.count)
+			for j := range sums {
+				sums[j] = sha256.Sum256([]byte{byte(j), byte(j >> 8)})
+			}
+
+			frames := sumsFrames(sums, "session1")
+			assert.Equal(t, tt.wantFrames, len(frames), "failed in case [%d]", i)
+			assert.Equal(t, tt.wantFrames, sumsFrameCount(tt.count), "failed in case [%d]", i)
+
+			result := make([]blockSum, tt.count)
+			for _, frame := range frames {
+				_, _, _, ok := parseSumsFrame(frame, "session0")
+				assert.False(t, ok, "failed in case [%d]", i)
+
+				start, total, frameSums, ok := parseSumsFrame(frame, "session1")
+				assert.True(t, ok, "failed in case [%d]", i)
+				assert.Equal(t, tt.count, total, "failed in case [%d]", i)
+				copy(result[start:], frameSums)
+			}
+			assert.Equal(t, sums, result, "failed in case [%d]", i)
+		})
+	}
+
+	for _, frame := range []string{"", "sums", "miss0000000001", "sumssession100000000010000000001abc"} {
+		_, _, _, ok := parseSumsFrame([]byte(frame), "session1")
+		assert.False(t, ok, frame)
+	}
+}
+
+func TestPlanCopies(t *testing.T) {
+	blockA := bytes.Repeat([]byte("a"), 10)
+	blockB := bytes.Repeat([]byte("b"), 10)
+	blockC := bytes.Repeat([]byte("c"), 10)
+	join := func(blocks ...[]byte) []byte {
+		return bytes.Join(blocks, nil)
+	}
+
+	tests := []struct {
+		name     string
+		existing []byte
+		data     []byte
+		want     map[int]int
+	}{{
+		name: "no existing file",
+		data: join(blockA, blockB),
+		want: map[int]int{},
+	}, {
+		name:     "same file",
+		existing: join(blockA, blockB, []byte("tail")),
+		data:     join(blockA, blockB, []byte("tail")),
+		want:     map[int]int{0: 0, 1: 1, 2: 2},
+	}, {
+		name:     "moved block",
+		existing: join(blockA, blockB),
+		data:     join(blockB, blockA, blockB),
+		want:     map[int]int{0: 1, 1: 0, 2: 1},
+	}, {
+		name:     "changed block",
+		existing: join(blockA, blockB, blockA),
+		data:     join(blockA, blockC, blockA),
+		want:     map[int]int{0: 0, 2: 2},
+	}}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sums, err := blockSums(bytes.NewReader(tt.existing), int64(len(tt.existing)), 10)
+			assert.Nil(t, err, "failed in case [%d]", i)
+
+			builder := NewReaderHeaderBuilder("fake", int64(len(tt.data))).WithChunk(10)
+			err = builder.Build()
+			assert.Nil(t, err, "failed in case [%d]", i)
+
+			copies, err := planCopies(bytes.NewReader(tt.data), builder, sums)
+			assert.Nil(t, err, "failed in case [%d]", i)
+			assert.Equal(t, tt.want, copies, "failed in case [%d]", i)
+		})
+	}
+}
+
+func TestExistingSums(t *testing.T) {
+	dir := t.TempDir()
+	original, sums, err := existingSums(filepath.Join(dir, "fake"), 10)
+	assert.Nil(t, err)
+	assert.Nil(t, original)
+	assert.Empty(t, sums)
+
+	file := filepath.Join(dir, "file")
+	assert.Nil(t, os.WriteFile(file, bytes.Repeat([]byte("a"), 25), 0640))
+	original, sums, err = existingSums(file, 10)
+	assert.Nil(t, err)
+	if assert.NotNil(t, original) {
+		_ = original.Close()
+	}
+	assert.Equal(t, 3, len(sums))
+	assert.Equal(t, sums[0], sums[1])
+	assert.NotEqual(t, sums[1], sums[2])
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !windows
+
+package pkg
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// FreeSpace returns the available bytes of the filesystem which the path belongs to
+func FreeSpace(path string) (size uint64, err error) {
+	err = fmt.Errorf("not support to get the free space on %s", runtime.GOOS)
+	return
+}
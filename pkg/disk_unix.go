@@ -0,0 +1,14 @@
+//go:build linux || darwin
+
+package pkg
+
+import "syscall"
+
+// FreeSpace returns the available bytes of the filesystem which the path belongs to
+func FreeSpace(path string) (size uint64, err error) {
+	stat := syscall.Statfs_t{}
+	if err = syscall.Statfs(path, &stat); err == nil {
+		size = uint64(stat.Bavail) * uint64(stat.Bsize)
+	}
+	return
+}
@@ -0,0 +1,25 @@
+//go:build windows
+
+package pkg
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var getDiskFreeSpaceEx = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+
+// FreeSpace returns the available bytes of the filesystem which the path belongs to
+func FreeSpace(path string) (size uint64, err error) {
+	var pathPtr *uint16
+	if pathPtr, err = syscall.UTF16PtrFromString(path); err != nil {
+		return
+	}
+
+	ret, _, callErr := getDiskFreeSpaceEx.Call(uintptr(unsafe.Pointer(pathPtr)),
+		uintptr(unsafe.Pointer(&size)), 0, 0)
+	if ret == 0 {
+		err = callErr
+	}
+	return
+}
@@ -0,0 +1,93 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// the errors of a session, check them with errors.Is.
+// ErrTimeout and ErrInsufficientSpace are the others, the latter one means the disk is full or the quota is exceeded.
+var (
+	// ErrPeerNotFound means there is no waiter which has the name, address or session code
+	ErrPeerNotFound = errors.New("peer not found")
+	// ErrRejected means the waiter rejected the file, the reason might be one of the other errors as well
+	ErrRejected = errors.New("rejected by the waiter")
+	// ErrAuthFailed means the sender signed the session with a different secret
+	ErrAuthFailed = errors.New("authentication failed")
+	// ErrChecksumMismatch means the received file is different from the sent one
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	// ErrCancelled means the session was cancelled by the context, such as an interrupt signal
+	ErrCancelled = errors.New("cancelled")
+)
+
+// the codes of the errors in the frames, the peer knows the kind of an error with them
+const (
+	codeOK = iota
+	codeFailed
+	codeAuthFailed
+	codeInsufficientSpace
+	codeChecksumMismatch
+)
+
+// errorCode returns the code of an error which is sent to the peer, it's codeOK if there is no error
+func errorCode(err error) (code int) {
+	switch {
+	case err == nil:
+		code = codeOK
+	case errors.Is(err, ErrAuthFailed):
+		code = codeAuthFailed
+	case errors.Is(err, ErrInsufficientSpace):
+		code = codeInsufficientSpace
+	case errors.Is(err, ErrChecksumMismatch):
+		code = codeChecksumMismatch
+	default:
+		code = codeFailed
+	}
+	return
+}
+
+// codeError returns the error of a code from the peer, it's nil if there is no specific error of the code
+func codeError(code int) (err error) {
+	switch code {
+	case codeAuthFailed:
+		err = ErrAuthFailed
+	case codeInsufficientSpace:
+		err = ErrInsufficientSpace
+	case codeChecksumMismatch:
+		err = ErrChecksumMismatch
+	}
+	return
+}
+
+// peerError is an error which the peer reported, it matches its kind and the error of its code
+type peerError struct {
+	message string
+	kinds   []error
+}
+
+// newPeerError creates an error of the kind, such as: ErrRejected, the code comes from the peer
+func newPeerError(kind error, code int, message string) error {
+	kinds := []error{kind}
+	if err := codeError(code); err != nil {
+		kinds = append(kinds, err)
+	}
+	return &peerError{message: message, kinds: kinds}
+}
+
+func (e *peerError) Error() string {
+	return e.message
+}
+
+// Unwrap returns the kinds of the error, it works with errors.Is
+func (e *peerError) Unwrap() []error {
+	return e.kinds
+}
+
+// diskError marks the error of writing a file as ErrInsufficientSpace if the disk is full
+func diskError(err error) error {
+	if errors.Is(err, syscall.ENOSPC) {
+		err = fmt.Errorf("%w, %w", ErrInsufficientSpace, err)
+	}
+	return err
+}
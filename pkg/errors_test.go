@@ -0,0 +1,70 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantCode int
+		wantErr  error
+	}{{
+		name:     "no error",
+		wantCode: codeOK,
+	}, {
+		name:     "unknown error",
+		err:      errors.New("fake"),
+		wantCode: codeFailed,
+	}, {
+		name:     "authentication failed",
+		err:      ErrAuthFailed,
+		wantCode: codeAuthFailed,
+		wantErr:  ErrAuthFailed,
+	}, {
+		name:     "wrapped insufficient space",
+		err:      fmt.Errorf("%w, 1 GB is required", ErrInsufficientSpace),
+		wantCode: codeInsufficientSpace,
+		wantErr:  ErrInsufficientSpace,
+	}, {
+		name:     "checksum mismatch",
+		err:      ErrChecksumMismatch,
+		wantCode: codeChecksumMismatch,
+		wantErr:  ErrChecksumMismatch,
+	}}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := errorCode(tt.err)
+			assert.Equal(t, tt.wantCode, code, "failed in case [%d]", i)
+			assert.Equal(t, tt.wantErr, codeError(code), "failed in case [%d]", i)
+		})
+	}
+}
+
+func TestPeerError(t *testing.T) {
+	err := newPeerError(ErrRejected, codeAuthFailed, "the waiter rejected the file: authentication failed")
+	assert.Equal(t, "the waiter rejected the file: authentication failed", err.Error())
+	assert.ErrorIs(t, err, ErrRejected)
+	assert.ErrorIs(t, err, ErrAuthFailed)
+	assert.NotErrorIs(t, err, ErrInsufficientSpace)
+
+	err = newPeerError(ErrRejected, codeFailed, "unsupported feature")
+	assert.ErrorIs(t, err, ErrRejected)
+	assert.NotErrorIs(t, err, ErrAuthFailed)
+}
+
+func TestDiskError(t *testing.T) {
+	err := diskError(&os.PathError{Op: "write", Path: "fake", Err: syscall.ENOSPC})
+	assert.ErrorIs(t, err, ErrInsufficientSpace)
+	assert.ErrorIs(t, err, syscall.ENOSPC)
+
+	err = diskError(&os.PathError{Op: "write", Path: "fake", Err: syscall.EACCES})
+	assert.NotErrorIs(t, err, ErrInsufficientSpace)
+}
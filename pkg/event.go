@@ -0,0 +1,120 @@
+package pkg
+
+import (
+	"time"
+)
+
+// the types of the events
+const (
+	// EventPeer means a waiter was found
+	EventPeer = "peer"
+	// EventStart means the waiter accepted the file
+	EventStart = "start"
+	// EventProgress reports the bytes which were sent or received
+	EventProgress = "progress"
+	// EventComplete means the file was sent or received
+	EventComplete = "complete"
+	// EventSummary is the result of a session, it's the last event
+	EventSummary = "summary"
+)
+
+// progressInterval is the interval of the progress events
+const progressInterval = time.Second
+
+// Event is a step of a session, it's a line of the machine-readable output
+type Event struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	// File is the path of the file to send or receive
+	File string `json:"file,omitempty"`
+	// Size is the size of the file
+	Size int64 `json:"size,omitempty"`
+	// Bytes is the count of the bytes which were sent or received
+	Bytes int64 `json:"bytes,omitempty"`
+	// Peer is the address of the peer
+	Peer     string `json:"peer,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Hostname string `json:"hostname,omitempty"`
+	Group    string `json:"group,omitempty"`
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// NewPeerEvent creates the event of a waiter which was found
+func NewPeerEvent(peer Peer) Event {
+	return Event{
+		Type:     EventPeer,
+		Time:     time.Now(),
+		Peer:     peer.Address(),
+		Name:     peer.Name,
+		Hostname: peer.Hostname,
+		Group:    peer.Group,
+	}
+}
+
+// Summary is the result of a session, the error is set if it failed
+type Summary struct {
+	Type string `json:"type"`
+	File string `json:"file"`
+	// Bytes is the count of the bytes which were sent or written, it's the size of the file if it succeeded
+	Bytes int64 `json:"bytes"`
+	// Duration is the seconds of the session
+	Duration float64 `json:"duration"`
+	// Throughput is the bytes per second
+	Throughput float64 `json:"throughput"`
+	// Retransmits is the count of the chunks which were sent again, or asked for again by the waiter
+	Retransmits int64 `json:"retransmits"`
+	// Checksum is the SHA-256 of the file, it's empty if the session failed
+	Checksum string `json:"checksum"`
+	Error    string `json:"error,omitempty"`
+}
+
+// newSummary creates a summary, the throughput is calculated from the bytes and the duration
+func newSummary(file string, bytes int64, duration time.Duration, retransmits int64, sum string) (summary Summary) {
+	summary = Summary{
+		Type:        EventSummary,
+		File:        file,
+		Bytes:       bytes,
+		Duration:    duration.Seconds(),
+		Retransmits: retransmits,
+		Checksum:    sum,
+	}
+	if duration > 0 {
+		summary.Throughput = float64(bytes) / duration.Seconds()
+	}
+	return
+}
+
+// emitter sends the events to a channel, nothing is sent if the channel is nil
+type emitter chan Event
+
+func (e emitter) emit(event Event) {
+	if e != nil {
+		event.Time = time.Now()
+		e <- event
+	}
+}
+
+// close closes the channel once the session is over
+func (e emitter) close() {
+	if e != nil {
+		close(e)
+	}
+}
+
+// reportProgress emits the progress every interval until it's done, the bytes are read from the function
+func (e emitter) reportProgress(file string, size int64, bytes func() int64, done chan struct{}) {
+	if e == nil {
+		return
+	}
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			e.emit(Event{Type: EventProgress, File: file, Size: size, Bytes: min(bytes(), size)})
+		}
+	}
+}
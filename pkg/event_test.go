@@ -0,0 +1,82 @@
+package pkg
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSummary(t *testing.T) {
+	tests := []struct {
+		name           string
+		size           int64
+		duration       time.Duration
+		wantThroughput float64
+	}{{
+		name:           "normal",
+		size:           1000,
+		duration:       2 * time.Second,
+		wantThroughput: 500,
+	}, {
+		name: "no duration",
+		size: 1000,
+	}}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summary := newSummary("fake", tt.size, tt.duration, 3, "sum")
+			assert.Equal(t, EventSummary, summary.Type, "failed in case [%d]", i)
+			assert.Equal(t, tt.wantThroughput, summary.Throughput, "failed in case [%d]", i)
+			assert.Equal(t, tt.duration.Seconds(), summary.Duration, "failed in case [%d]", i)
+			assert.Equal(t, int64(3), summary.Retransmits, "failed in case [%d]", i)
+		})
+	}
+}
+
+func TestEvent(t *testing.T) {
+	peer := Peer{Name: "laptop", Hostname: "host", Port: 3000, IP: "192.168.1.2"}
+	data, err := json.Marshal(NewPeerEvent(peer))
+	assert.Nil(t, err)
+
+	result := map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal(data, &result))
+	assert.Equal(t, EventPeer, result["type"])
+	assert.Equal(t, net.JoinHostPort("192.168.1.2", "3000"), result["peer"])
+	assert.Equal(t, "laptop", result["name"])
+	// the empty fields are omitted
+	assert.NotContains(t, result, "size")
+	assert.NotContains(t, result, "checksum")
+	assert.NotContains(t, result, "group")
+}
+
+func TestEmitter(t *testing.T) {
+	// nothing happens without a channel
+	var none emitter
+	none.emit(Event{Type: EventStart})
+	none.reportProgress("fake", 10, nil, nil)
+	none.close()
+
+	events := make(chan Event, 10)
+	e := emitter(events)
+	e.emit(Event{Type: EventStart})
+	assert.Equal(t, EventStart, (<-events).Type)
+
+	done := make(chan struct{})
+	go func() {
+		time.Sleep(progressInterval + progressInterval/2)
+		close(done)
+	}()
+	e.reportProgress("fake", 10, func() int64 {
+		// the bytes never exceed the size
+		return 20
+	}, done)
+	e.close()
+
+	progress := <-events
+	assert.Equal(t, EventProgress, progress.Type)
+	assert.Equal(t, int64(10), progress.Bytes)
+	_, ok := <-events
+	assert.False(t, ok)
+}
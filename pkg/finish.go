@@ -0,0 +1,169 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// finPrefix tells the sender the session is over, the code is 0 if all the chunks were written,
+	// format: fini + session + code (10) + checksum, the checksum is the SHA-256 of the written file,
+	// it is empty if the file could not be read
+	finPrefix = "fini"
+	// finAckPrefix acknowledges the FIN, the code is not 0 if the checksum is different,
+	// format: fack + session + code (10)
+	finAckPrefix = "fack"
+	// finInterval is the interval of sending the FIN again if it's not acknowledged
+	finInterval = 500 * time.Millisecond
+	// finRetries is the count of sending the FIN
+	finRetries = 10
+	// finLinger is the duration of acknowledging the FIN again in case the FIN-ACK was lost
+	finLinger = 3 * finInterval
+	// abortPrefix tells the waiter the sender could not send the file, such as it failed to read the data,
+	// format: abrt + session + code (10) + reason
+	abortPrefix = "abrt"
+	// abortRetries is the count of sending the abort, nobody acknowledges it
+	abortRetries = 3
+)
+
+// ErrReceiveFailed means the waiter failed to write the file
+var ErrReceiveFailed = errors.New("the waiter failed to receive the file")
+
+// ErrSendFailed means the sender failed to send the file, such as it could not read the data.
+// The waiter gets it from the abort of the sender.
+var ErrSendFailed = errors.New("the sender failed to send the file")
+
+// completion is the FIN/FIN-ACK exchange of a session on the waiter side
+type completion struct {
+	session  string
+	interval time.Duration
+	retries  int
+	acked    chan struct{}
+	once     sync.Once
+	// result is the error which the sender acknowledged with, such as ErrChecksumMismatch
+	result error
+}
+
+func newCompletion(session string) *completion {
+	return &completion{
+		session:  session,
+		interval: finInterval,
+		retries:  finRetries,
+		acked:    make(chan struct{}),
+	}
+}
+
+// acknowledge checks if the frame is the FIN-ACK of the session, it's safe to be called by multiple goroutines
+func (c *completion) acknowledge(frame []byte) (ok bool) {
+	var code int
+	if code, ok = parseControlFrame(frame, finAckPrefix, c.session); ok {
+		c.once.Do(func() {
+			if err := codeError(code); err != nil {
+				c.result = fmt.Errorf("%w, the sender has a different checksum of the file", err)
+			}
+			close(c.acked)
+		})
+	}
+	return
+}
+
+// finish sends the FIN until the sender acknowledges it, the failure tells the sender the file was not written.
+// The checksum of the file is sent for the sender to verify, the error is the result of it.
+// The FIN-ACK is read by the receiving goroutines, see acknowledge.
+func (c *completion) finish(conn net.PacketConn, remote net.Addr, failure error, sum string) (err error) {
+	frame := append(controlFrame(finPrefix, c.session, errorCode(failure)), sum...)
+	for i := 0; i < c.retries; i++ {
+		if _, err = conn.WriteTo(frame, remote); err != nil {
+			return
+		}
+
+		select {
+		case <-c.acked:
+			err = c.result
+			return
+		case <-time.After(c.interval):
+		}
+	}
+	err = fmt.Errorf("%w: the sender did not acknowledge the end of the session in %v",
+		ErrTimeout, c.interval*time.Duration(c.retries))
+	return
+}
+
+// checkFinish parses the FIN of the session, the error is not nil if the waiter failed to write the file,
+// or the checksum of the written file is different from the expected one. The checksum is not verified if it's nil.
+func checkFinish(message []byte, session string, expected *sourceChecksum) (ok bool, err error) {
+	var code int
+	var sum string
+	if code, sum, ok = parseControlPayload(message, finPrefix, session); !ok {
+		return
+	}
+
+	if code != codeOK {
+		message := ErrReceiveFailed.Error()
+		if kind := codeError(code); kind != nil {
+			message += ": " + kind.Error()
+		}
+		err = newPeerError(ErrReceiveFailed, code, message)
+	} else if expected != nil && sum != "" {
+		// the sum is empty if the waiter could not read what it wrote, such as an upload to an object storage
+		if want, sumErr := expected.wait(); sumErr != nil {
+			err = fmt.Errorf("failed to calculate the checksum, %v", sumErr)
+		} else if sum != want {
+			err = fmt.Errorf("%w, the waiter wrote %s but it should be %s", ErrChecksumMismatch, sum, want)
+		}
+	}
+	return
+}
+
+// acknowledgeFinish acknowledges the FIN with the result of it, and keeps acknowledging the ones which are sent again
+// in the background for a while in case the FIN-ACK was lost. The connection is closed once it's over.
+func acknowledgeFinish(conn net.Conn, session string, result error) {
+	// the waiter knows the file is broken if the checksum is different
+	code := codeOK
+	if errors.Is(result, ErrChecksumMismatch) {
+		code = codeChecksumMismatch
+	}
+	ack := controlFrame(finAckPrefix, session, code)
+	_, _ = conn.Write(ack)
+	go lingerFinish(conn, session, ack)
+}
+
+// lingerFinish acknowledges the FINs which are sent again until the linger expires or the connection was closed
+func lingerFinish(conn net.Conn, session string, ack []byte) {
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	message := make([]byte, 128)
+	_ = conn.SetReadDeadline(time.Now().Add(finLinger))
+	for {
+		n, err := conn.Read(message)
+		if err != nil {
+			return
+		}
+		if ok, _ := checkFinish(message[:n], session, nil); ok {
+			_, _ = conn.Write(ack)
+		}
+	}
+}
+
+// abortSession tells the waiter the session failed, the waiter stops asking for the chunks
+func abortSession(conn net.Conn, session string, reason error) {
+	frame := append(controlFrame(abortPrefix, session, errorCode(reason)), reason.Error()...)
+	for i := 0; i < abortRetries; i++ {
+		_, _ = conn.Write(frame)
+	}
+}
+
+// checkAbort parses the abort of the session, the error has the reason of the sender
+func checkAbort(message []byte, session string) (ok bool, err error) {
+	var code int
+	var reason string
+	if code, reason, ok = parseControlPayload(message, abortPrefix, session); ok {
+		err = newPeerError(ErrSendFailed, code, reason)
+	}
+	return
+}
@@ -0,0 +1,207 @@
+package pkg
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckFinish(t *testing.T) {
+	data := strings.NewReader("hello")
+	sum, err := checksum(data, data.Size())
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name    string
+		message []byte
+		wantOK  bool
+		wantErr []error
+	}{{
+		name:    "received",
+		message: append(controlFrame(finPrefix, "session1", codeOK), sum...),
+		wantOK:  true,
+	}, {
+		name:    "checksum mismatch",
+		message: append(controlFrame(finPrefix, "session1", codeOK), strings.Repeat("0", checksumLength)...),
+		wantOK:  true,
+		wantErr: []error{ErrChecksumMismatch},
+	}, {
+		name:    "the waiter could not read the file",
+		message: controlFrame(finPrefix, "session1", codeOK),
+		wantOK:  true,
+	}, {
+		name:    "failed",
+		message: controlFrame(finPrefix, "session1", codeFailed),
+		wantOK:  true,
+		wantErr: []error{ErrReceiveFailed},
+	}, {
+		name:    "disk full",
+		message: controlFrame(finPrefix, "session1", codeInsufficientSpace),
+		wantOK:  true,
+		wantErr: []error{ErrReceiveFailed, ErrInsufficientSpace},
+	}, {
+		name:    "another session",
+		message: controlFrame(finPrefix, "session0", 0),
+	}, {
+		name:    "missing request",
+		message: controlFrame("miss", "session1", 0),
+	}}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := checkFinish(tt.message, "session1", newSourceChecksum(data, data.Size()))
+			assert.Equal(t, tt.wantOK, ok, "failed in case [%d]", i)
+			assert.Equal(t, len(tt.wantErr) > 0, err != nil, "failed in case [%d]", i)
+			for _, wantErr := range tt.wantErr {
+				assert.ErrorIs(t, err, wantErr, "failed in case [%d]", i)
+			}
+		})
+	}
+}
+
+func TestCheckAbort(t *testing.T) {
+	ok, err := checkAbort(append(controlFrame(abortPrefix, "session1", codeFailed), "broken reader"...), "session1")
+	assert.True(t, ok)
+	assert.ErrorIs(t, err, ErrSendFailed)
+	assert.Equal(t, "broken reader", err.Error())
+
+	ok, _ = checkAbort(controlFrame(abortPrefix, "session0", codeFailed), "session1")
+	assert.False(t, ok)
+	ok, _ = checkAbort(controlFrame(finPrefix, "session1", codeFailed), "session1")
+	assert.False(t, ok)
+}
+
+func TestCompletion(t *testing.T) {
+	data := strings.NewReader("hello")
+	sum, err := checksum(data, data.Size())
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name         string
+		failure      error
+		sum          string
+		ackLost      int
+		wantErr      error
+		wantReceived error
+	}{{
+		name: "acknowledged",
+		sum:  sum,
+	}, {
+		name:    "the FIN-ACK was lost",
+		sum:     sum,
+		ackLost: 2,
+	}, {
+		name:         "failed to receive",
+		failure:      errors.New("no space"),
+		wantReceived: ErrReceiveFailed,
+	}, {
+		name:         "checksum mismatch",
+		sum:          strings.Repeat("0", checksumLength),
+		wantErr:      ErrChecksumMismatch,
+		wantReceived: ErrChecksumMismatch,
+	}, {
+		name:    "not acknowledged",
+		sum:     sum,
+		ackLost: 100,
+		wantErr: ErrTimeout,
+	}}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := net.ListenPacket("udp", "127.0.0.1:0")
+			assert.Nil(t, err, "failed in case [%d]", i)
+			defer func() {
+				_ = server.Close()
+			}()
+			conn, err := net.Dial("udp", server.LocalAddr().String())
+			assert.Nil(t, err, "failed in case [%d]", i)
+			defer func() {
+				_ = conn.Close()
+			}()
+
+			fin := newCompletion("session1")
+			fin.interval, fin.retries = 20*time.Millisecond, 5
+			// the receiving goroutine of the waiter
+			go func() {
+				message := make([]byte, 128)
+				for {
+					n, _, readErr := server.ReadFrom(message)
+					if readErr != nil {
+						return
+					}
+					fin.acknowledge(message[:n])
+				}
+			}()
+
+			// the sender drops some of the FINs to emulate the lost FIN-ACKs
+			result := make(chan error, 1)
+			go func() {
+				message := make([]byte, 128)
+				for lost := 0; ; lost++ {
+					n, readErr := conn.Read(message)
+					if readErr != nil {
+						return
+					}
+					ok, finErr := checkFinish(message[:n], "session1", newSourceChecksum(data, data.Size()))
+					if ok && lost >= tt.ackLost {
+						result <- finErr
+						code := codeOK
+						if errors.Is(finErr, ErrChecksumMismatch) {
+							code = codeChecksumMismatch
+						}
+						_, _ = conn.Write(controlFrame(finAckPrefix, "session1", code))
+						return
+					}
+				}
+			}()
+
+			err = fin.finish(server, conn.LocalAddr(), tt.failure, tt.sum)
+			if tt.wantErr == nil {
+				assert.Nil(t, err, "failed in case [%d]", i)
+			} else {
+				assert.ErrorIs(t, err, tt.wantErr, "failed in case [%d]", i)
+			}
+			if !errors.Is(tt.wantErr, ErrTimeout) {
+				received := <-result
+				if tt.wantReceived == nil {
+					assert.Nil(t, received, "failed in case [%d]", i)
+				} else {
+					assert.ErrorIs(t, received, tt.wantReceived, "failed in case [%d]", i)
+				}
+			}
+		})
+	}
+}
+
+func TestAcknowledgeFinish(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer func() {
+		_ = server.Close()
+	}()
+	conn, err := net.Dial("udp", server.LocalAddr().String())
+	assert.Nil(t, err)
+
+	// the FIN is sent again since the first FIN-ACK was lost, it's acknowledged in the background
+	_, err = server.WriteTo(controlFrame(finPrefix, "session1", 0), conn.LocalAddr())
+	assert.Nil(t, err)
+	begin := time.Now()
+	acknowledgeFinish(conn, "session1", nil)
+	assert.Less(t, time.Since(begin), finLinger)
+
+	message := make([]byte, 64)
+	for i := 0; i < 2; i++ {
+		_ = server.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, readErr := server.ReadFrom(message)
+		assert.Nil(t, readErr)
+		assert.Equal(t, controlFrame(finAckPrefix, "session1", 0), message[:n])
+	}
+
+	// the connection is closed once the linger expires
+	assert.Eventually(t, func() bool {
+		_, writeErr := conn.Write([]byte("ping"))
+		return errors.Is(writeErr, net.ErrClosed)
+	}, 2*finLinger, 100*time.Millisecond)
+}
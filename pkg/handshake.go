@@ -0,0 +1,226 @@
+package pkg
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// offerPrefix is the prefix of the offer which the sender starts a session with, the offer follows it in JSON
+	offerPrefix = "offr"
+	// acceptPrefix tells the sender the file was set up, the session ID follows it
+	acceptPrefix = "acpt"
+	// rejectPrefix tells the sender the file was rejected, format: rjct + session + code (10) + reason,
+	// the code tells the kind of the reason, see errorCode
+	rejectPrefix = "rjct"
+	// sessionIDLength is the length of the random session ID
+	sessionIDLength = 8
+	// handshakeTimeout is the duration of waiting for the answer of the offer
+	handshakeTimeout = 10 * time.Second
+	// offerInterval is the interval of sending the offer again
+	offerInterval = 500 * time.Millisecond
+)
+
+// supportedFeatures are the features of the offer which the waiter accepts
+var supportedFeatures = []string{FeatureCompression, FeatureDelta}
+
+// offer describes the file which the sender is going to send
+type offer struct {
+	Session  string   `json:"session"`
+	Version  int      `json:"version"`
+	Filename string   `json:"filename"`
+	Length   int64    `json:"length"`
+	Chunk    int      `json:"chunk"`
+	Count    int      `json:"count"`
+	Parallel int      `json:"parallel"`
+	Features []string `json:"features,omitempty"`
+	// Auth is the HMAC of the other fields with the shared secret, it's empty without a secret
+	Auth string `json:"auth,omitempty"`
+}
+
+// newOffer creates an offer of the file, the session ID is the one of the builder
+func newOffer(builder *HeaderBuilder, parallel int, secret string, features ...string) (o offer) {
+	o = offer{
+		Session:  builder.session,
+		Version:  ProtocolVersion,
+		Filename: builder.GetFilename(),
+		Length:   builder.GetFileSize(),
+		Chunk:    builder.GetChunk(),
+		Count:    builder.GetBufferCount(),
+		Parallel: parallel,
+		Features: features,
+	}
+	if secret != "" {
+		o.Auth = o.sign(secret)
+	}
+	return
+}
+
+// sign returns the HMAC of the offer with the shared secret, it covers the JSON of all the fields except Auth,
+// so none of them could be changed on the way
+func (o offer) sign(secret string) string {
+	o.Auth = ""
+	payload, _ := json.Marshal(o)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// frame encodes the offer
+func (o offer) frame() []byte {
+	payload, _ := json.Marshal(o)
+	return append([]byte(offerPrefix), payload...)
+}
+
+// parseOffer decodes an offer, it's not ok if the frame is not an offer
+func parseOffer(frame []byte) (o offer, ok bool) {
+	if !strings.HasPrefix(string(frame), offerPrefix) {
+		return
+	}
+	ok = json.Unmarshal(frame[len(offerPrefix):], &o) == nil && o.Session != ""
+	return
+}
+
+// header returns the header of the file, the first chunk might not be received in the data phase
+func (o offer) header(remote net.Addr) dataHeader {
+	return dataHeader{
+		length:   int(o.Length),
+		filename: o.Filename,
+		chrunk:   o.Chunk,
+		count:    o.Count,
+		session:  o.Session,
+		remote:   remote,
+	}
+}
+
+// supports checks if the offer asks for the feature
+func (o offer) supports(feature string) bool {
+	return Peer{Features: o.Features}.Supports(feature)
+}
+
+// verify checks if the waiter is able to receive the offer, the chunk should not exceed the limit of the transport
+func (o offer) verify(secret string, parallel, limit int) (err error) {
+	switch {
+	case o.Version != ProtocolVersion:
+		err = fmt.Errorf("unsupported protocol version %d, the waiter speaks version %d", o.Version, ProtocolVersion)
+	case secret != "" && !hmac.Equal([]byte(o.Auth), []byte(o.sign(secret))):
+		err = ErrAuthFailed
+	case o.Chunk <= 0 || o.Chunk > limit || o.Length < 0 || o.Count < 0:
+		err = fmt.Errorf("invalid chunk size %d or file length %d", o.Chunk, o.Length)
+	case o.Parallel > parallel:
+		err = fmt.Errorf("the sender sends to %d ports but the waiter listens to %d", o.Parallel, parallel)
+	}
+	if err != nil {
+		return
+	}
+
+	for _, feature := range o.Features {
+		if !(Peer{Features: supportedFeatures}).Supports(feature) {
+			err = fmt.Errorf("unsupported feature %q", feature)
+			return
+		}
+	}
+	return
+}
+
+// readOffer waits for an offer, the other frames are ignored since they might be delayed from a previous run
+func readOffer(conn net.PacketConn) (o offer, remote net.Addr, err error) {
+	message := make([]byte, maxDatagramSize)
+	for {
+		var n int
+		if n, remote, err = conn.ReadFrom(message); err != nil {
+			return
+		}
+		var ok bool
+		if o, ok = parseOffer(message[:n]); ok {
+			return
+		}
+	}
+}
+
+// replyAccept tells the sender the file was set up
+func replyAccept(conn net.PacketConn, remote net.Addr, session string) (err error) {
+	_, err = conn.WriteTo([]byte(acceptPrefix+session), remote)
+	return
+}
+
+// replyReject tells the sender the reason of rejecting the file
+func replyReject(conn net.PacketConn, remote net.Addr, session string, reason error) (err error) {
+	_, err = conn.WriteTo(append(controlFrame(rejectPrefix, session, errorCode(reason)), reason.Error()...), remote)
+	return
+}
+
+// handshake sends the offer until the waiter accepts or rejects it
+func handshake(conn net.Conn, o offer, timeout time.Duration) (err error) {
+	defer func() {
+		_ = conn.SetReadDeadline(time.Time{})
+	}()
+
+	frame := o.frame()
+	message := make([]byte, 1024)
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); {
+		if _, err = conn.Write(frame); errors.Is(err, net.ErrClosed) {
+			return
+		} else if err != nil {
+			time.Sleep(offerInterval)
+			continue
+		}
+
+		_ = conn.SetReadDeadline(time.Now().Add(offerInterval))
+		for {
+			n, readErr := conn.Read(message)
+			if readErr != nil {
+				if !errors.Is(readErr, os.ErrDeadlineExceeded) {
+					// the waiter is not ready, such as: connection refused
+					time.Sleep(offerInterval)
+				}
+				break
+			}
+
+			if string(message[:n]) == acceptPrefix+o.Session {
+				err = nil
+				return
+			} else if code, reason, ok := parseControlPayload(message[:n], rejectPrefix, o.Session); ok {
+				err = newPeerError(ErrRejected, code, "the waiter rejected the file: "+reason)
+				return
+			}
+		}
+	}
+	err = fmt.Errorf("%w: no answer from the waiter in %v", ErrTimeout, timeout)
+	return
+}
+
+// controlFrame returns a frame which the waiter controls the sender with,
+// format: prefix + session + number (10), such as: miss + session + 12
+func controlFrame(prefix, session string, number int) []byte {
+	return []byte(prefix + fillContainer(session, sessionIDLength) + fillContainerWithNumber(number, 10))
+}
+
+// parseControlFrame returns the number of the frame, it's not ok if the frame belongs to another session
+func parseControlFrame(message []byte, prefix, session string) (number int, ok bool) {
+	number, _, ok = parseControlPayload(message, prefix, session)
+	return
+}
+
+// parseControlPayload returns the number of the frame, and the payload which follows the number
+func parseControlPayload(message []byte, prefix, session string) (number int, payload string, ok bool) {
+	head := prefix + fillContainer(session, sessionIDLength)
+	if !strings.HasPrefix(string(message), head) {
+		return
+	}
+
+	end := min(len(message), len(head)+10)
+	var err error
+	number, err = strconv.Atoi(strings.TrimSpace(string(message[len(head):end])))
+	payload, ok = string(message[end:]), err == nil
+	return
+}
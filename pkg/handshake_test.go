@@ -0,0 +1,232 @@
+package pkg
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOffer(t *testing.T) {
+	builder := NewReaderHeaderBuilder("dir/fake", 120001).WithChunk(60000).WithSession("session1")
+	assert.Nil(t, builder.Build())
+
+	o := newOffer(builder, 2, "secret", FeatureCompression)
+	assert.Equal(t, "session1", o.Session)
+	assert.NotEqual(t, o.Auth, newOffer(builder.WithSession("session2"), 2, "secret").Auth)
+
+	result, ok := parseOffer(o.frame())
+	assert.True(t, ok)
+	assert.Equal(t, o, result)
+	assert.True(t, result.supports(FeatureCompression))
+	assert.False(t, result.supports(FeatureDelta))
+
+	header := result.header(nil)
+	assert.Equal(t, 120001, header.length)
+	assert.Equal(t, "fake", header.filename)
+	assert.Equal(t, 60000, header.chrunk)
+	assert.Equal(t, 3, header.count)
+	assert.Equal(t, "session1", header.session)
+
+	for _, frame := range []string{"", "offr", "offr{}", "miss0000000001"} {
+		_, ok = parseOffer([]byte(frame))
+		assert.False(t, ok, frame)
+	}
+}
+
+func TestOfferVerify(t *testing.T) {
+	builder := NewReaderHeaderBuilder("fake", 100).WithChunk(10).WithSession("session1")
+	assert.Nil(t, builder.Build())
+
+	tests := []struct {
+		name     string
+		offer    offer
+		secret   string
+		parallel int
+		// limit is the chunk limit of the waiter's transport, it's maxChunk if it's zero
+		limit   int
+		wantErr bool
+	}{{
+		name:     "normal",
+		offer:    newOffer(builder, 1, ""),
+		parallel: 1,
+	}, {
+		name:     "with secret",
+		offer:    newOffer(builder, 1, "secret", FeatureCompression, FeatureDelta),
+		secret:   "secret",
+		parallel: 1,
+	}, {
+		name:     "wrong secret",
+		offer:    newOffer(builder, 1, "wrong"),
+		secret:   "secret",
+		parallel: 1,
+		wantErr:  true,
+	}, {
+		name:     "no secret",
+		offer:    newOffer(builder, 1, ""),
+		secret:   "secret",
+		parallel: 1,
+		wantErr:  true,
+	}, {
+		name: "tampered after signing",
+		offer: func() (o offer) {
+			o = newOffer(builder, 1, "secret")
+			o.Filename = "other"
+			return
+		}(),
+		secret:   "secret",
+		parallel: 1,
+		wantErr:  true,
+	}, {
+		name: "features are signed",
+		offer: func() (o offer) {
+			o = newOffer(builder, 1, "secret", FeatureDelta)
+			o.Features = nil
+			return
+		}(),
+		secret:   "secret",
+		parallel: 1,
+		wantErr:  true,
+	}, {
+		name:     "more ports than the waiter",
+		offer:    newOffer(builder, 4, ""),
+		parallel: 2,
+		wantErr:  true,
+	}, {
+		name:     "unsupported feature",
+		offer:    newOffer(builder, 1, "", FeatureFEC),
+		parallel: 1,
+		wantErr:  true,
+	}, {
+		name:     "other protocol version",
+		offer:    offer{Session: "fake", Version: ProtocolVersion + 1, Chunk: 10},
+		parallel: 1,
+		wantErr:  true,
+	}, {
+		name:     "invalid chunk",
+		offer:    offer{Session: "fake", Version: ProtocolVersion},
+		parallel: 1,
+		wantErr:  true,
+	}, {
+		name:     "chunk exceeds the limit of the transport",
+		offer:    offer{Session: "fake", Version: ProtocolVersion, Chunk: maxChunk},
+		parallel: 1,
+		limit:    chunkLimit(&RelayTransport{}),
+		wantErr:  true,
+	}, {
+		name:     "max chunk",
+		offer:    offer{Session: "fake", Version: ProtocolVersion, Chunk: maxChunk},
+		parallel: 1,
+	}}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limit := tt.limit
+			if limit == 0 {
+				limit = maxChunk
+			}
+			err := tt.offer.verify(tt.secret, tt.parallel, limit)
+			assert.Equal(t, tt.wantErr, err != nil, "failed in case [%d]", i)
+		})
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	o := offer{Session: "session1"}
+	tests := []struct {
+		name    string
+		answers []string
+		wantErr error
+	}{{
+		name:    "accepted",
+		answers: []string{"load0000000010", acceptPrefix + "session0", acceptPrefix + o.Session},
+	}, {
+		name:    "rejected",
+		answers: []string{string(controlFrame(rejectPrefix, o.Session, codeInsufficientSpace)) + "no space"},
+		wantErr: ErrInsufficientSpace,
+	}, {
+		name:    "the answer of other sessions",
+		answers: []string{acceptPrefix + "session0"},
+		wantErr: ErrTimeout,
+	}}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := net.ListenPacket("udp", "127.0.0.1:0")
+			assert.Nil(t, err, "failed in case [%d]", i)
+			defer func() {
+				_ = server.Close()
+			}()
+			conn, err := net.Dial("udp", server.LocalAddr().String())
+			assert.Nil(t, err, "failed in case [%d]", i)
+			defer func() {
+				_ = conn.Close()
+			}()
+
+			go func() {
+				message := make([]byte, 1024)
+				n, remote, readErr := server.ReadFrom(message)
+				if readErr != nil {
+					return
+				}
+				if received, ok := parseOffer(message[:n]); ok && received.Session == o.Session {
+					for _, answer := range tt.answers {
+						_, _ = server.WriteTo([]byte(answer), remote)
+					}
+				}
+			}()
+
+			err = handshake(conn, o, 200*time.Millisecond)
+			if tt.wantErr == nil {
+				assert.Nil(t, err, "failed in case [%d]", i)
+			} else {
+				assert.ErrorIs(t, err, tt.wantErr, "failed in case [%d]", i)
+			}
+		})
+	}
+}
+
+func TestReplyReject(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer func() {
+		_ = server.Close()
+	}()
+	conn, err := net.Dial("udp", server.LocalAddr().String())
+	assert.Nil(t, err)
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	o := offer{Session: "session1"}
+	// the stale frames are ignored
+	_, err = conn.Write(controlFrame("miss", "session0", 1))
+	assert.Nil(t, err)
+	_, err = conn.Write(o.frame())
+	assert.Nil(t, err)
+	received, remote, err := readOffer(server)
+	assert.Nil(t, err)
+	assert.Equal(t, o.Session, received.Session)
+
+	assert.Nil(t, replyReject(server, remote, o.Session, fmt.Errorf("%w, no space", ErrInsufficientSpace)))
+	err = handshake(conn, o, time.Second)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "no space")
+		assert.ErrorIs(t, err, ErrRejected)
+		assert.ErrorIs(t, err, ErrInsufficientSpace)
+	}
+}
+
+func TestControlFrame(t *testing.T) {
+	frame := controlFrame("miss", "session1", 12)
+	assert.Equal(t, "misssession1        12", string(frame))
+
+	index, ok := parseControlFrame(frame, "miss", "session1")
+	assert.True(t, ok)
+	assert.Equal(t, 12, index)
+
+	_, ok = parseControlFrame(frame, "miss", "session0")
+	assert.False(t, ok)
+	_, ok = parseControlFrame(frame, "load", "session1")
+	assert.False(t, ok)
+}
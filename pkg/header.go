@@ -10,22 +10,30 @@ import (
 	"strings"
 )
 
+// headerLength is the length of the header in front of the data of each chunk
+const headerLength = 150 + sessionIDLength
+
+// maxChunk makes sure a chunk and its header fit a UDP datagram
+const maxChunk = 65507 - headerLength
+
 type dataHeader struct {
 	length   int    // 20 bit
 	filename string // 100 bit
 	chrunk   int    // 10 bit
 	count    int    // 10 bit
-	index    int    // 10 bit
+	index    int    // 10 bit, the codec letter is in front of it if the data is compressed
+	session  string // 8 bit
+	codec    byte
 	data     []byte
 
-	remote *net.UDPAddr
+	remote net.Addr
 }
 
 func readHeaderFromData(data ReceivedData) (header dataHeader, err error) {
 	message := data.Data
 	rlen := len(message)
-	if rlen <= 150 {
-		err = fmt.Errorf("invalid header format, message length should bigger than 150, current is %d", rlen)
+	if rlen <= headerLength {
+		err = fmt.Errorf("invalid header format, message length should bigger than %d, current is %d", headerLength, rlen)
 		return
 	}
 
@@ -34,6 +42,7 @@ func readHeaderFromData(data ReceivedData) (header dataHeader, err error) {
 	chrunk := string(message[120:130])
 	count := string(message[130:140])
 	index := string(message[140:150])
+	header.session = strings.TrimSpace(string(message[150:headerLength]))
 
 	if header.length, err = strconv.Atoi(strings.TrimSpace(length)); err != nil {
 		err = fmt.Errorf("invalid length: '%s'", string(message[:20]))
@@ -46,26 +55,18 @@ func readHeaderFromData(data ReceivedData) (header dataHeader, err error) {
 	if header.count, err = strconv.Atoi(strings.TrimSpace(count)); err != nil {
 		return
 	}
-	if header.index, err = strconv.Atoi(strings.TrimSpace(index)); err != nil {
+	if index = strings.TrimSpace(index); index != "" && index[0] >= 'a' && index[0] <= 'z' {
+		header.codec, index = index[0], index[1:]
+	}
+	if header.index, err = strconv.Atoi(index); err != nil {
 		return
 	}
 
 	header.remote = data.Remote
-	header.data = message[150:rlen]
+	header.data = message[headerLength:rlen]
 	return
 }
 
-func readHeader(conn *net.UDPConn) (header dataHeader, err error) {
-	message := make([]byte, 65507)
-	var rlen int
-	data := ReceivedData{}
-	if rlen, data.Remote, err = conn.ReadFromUDP(message[:]); err != nil {
-		return
-	}
-	data.Data = message[:rlen]
-	return readHeaderFromData(data)
-}
-
 type HeaderBuilder struct {
 	file string
 
@@ -73,6 +74,7 @@ type HeaderBuilder struct {
 	fileSize    int64
 	chunk       int
 	bufferCount int
+	session     string
 }
 
 // NewHeaderBuilder creates an instance of the HeaderBuilder
@@ -82,17 +84,28 @@ func NewHeaderBuilder(file string) *HeaderBuilder {
 	}
 }
 
-func (h *HeaderBuilder) Build() (err error) {
-	var fi os.FileInfo
-	if fi, err = os.Stat(h.file); err != nil {
-		return
+// NewReaderHeaderBuilder creates an instance of the HeaderBuilder for the data which is not a local file
+func NewReaderHeaderBuilder(filename string, size int64) *HeaderBuilder {
+	return &HeaderBuilder{
+		filename: path.Base(filename),
+		fileSize: size,
 	}
+}
 
-	h.fileSize = fi.Size()
-	h.filename = path.Base(fi.Name())
+func (h *HeaderBuilder) Build() (err error) {
+	if h.file != "" {
+		var fi os.FileInfo
+		if fi, err = os.Stat(h.file); err != nil {
+			return
+		}
+
+		h.fileSize = fi.Size()
+		h.filename = path.Base(fi.Name())
+	}
 
-	switch runtime.GOOS {
-	case "darwin":
+	switch {
+	case h.chunk > 0:
+	case runtime.GOOS == "darwin":
 		h.chunk = 9000 // default value on darwin is 9216
 	default:
 		h.chunk = 60000
@@ -113,16 +126,37 @@ func (h *HeaderBuilder) Build() (err error) {
 	return
 }
 
+// WithChunk sets the chunk size, the default one depends on the OS if it's zero
+func (h *HeaderBuilder) WithChunk(chunk int) *HeaderBuilder {
+	h.chunk = chunk
+	return h
+}
+
+// WithSession sets the session ID which every chunk carries
+func (h *HeaderBuilder) WithSession(session string) *HeaderBuilder {
+	h.session = session
+	return h
+}
+
 // CreateHeader creates the header with index
 func (h *HeaderBuilder) CreateHeader(index int, data []byte) []byte {
-	// length,filename,count,index
-	header := fmt.Sprintf("%s%s%s%s%s",
+	return append([]byte(h.headerWithCodec(index, 0)), data...)
+}
+
+// headerWithCodec returns the header of a chunk, it's length,filename,chunk,count,index,session.
+// The codec letter is put in front of the index if it's not zero.
+func (h *HeaderBuilder) headerWithCodec(index int, codec byte) string {
+	indexField := strconv.Itoa(index)
+	if codec != 0 {
+		indexField = string(codec) + indexField
+	}
+	return fmt.Sprintf("%s%s%s%s%s%s",
 		fillContainerWithNumber(int(h.GetFileSize()), 20),
 		fillContainer(h.GetFilename(), 100),
 		fillContainerWithNumber(h.GetChunk(), 10),
 		fillContainerWithNumber(h.GetBufferCount(), 10),
-		fillContainerWithNumber(index, 10))
-	return append([]byte(header), data...)
+		fillContainer(indexField, 10),
+		fillContainer(h.session, sessionIDLength))
 }
 
 // GetChunk returns the chunk size
@@ -20,7 +20,35 @@ func TestHeaderBuilder(t *testing.T) {
 	assert.Nil(t, builder.Build())
 
 	data := builder.CreateHeader(1, []byte("hello"))
-	assert.Equal(t, []byte("                   5                                                                                                fake     60000         1         1hello"), data)
+	assert.Equal(t, []byte("                   5                                                                                                fake     60000         1         1        hello"), data)
+
+	data = builder.WithSession("session1").CreateHeader(1, []byte("hello"))
+	assert.Equal(t, []byte("                   5                                                                                                fake     60000         1         1session1hello"), data)
+}
+
+func TestHeaderWithCodec(t *testing.T) {
+	builder := NewReaderHeaderBuilder("fake", 5)
+	assert.Nil(t, builder.Build())
+
+	data := append([]byte(builder.headerWithCodec(12, codecZstd)), "data"...)
+	header, err := readHeaderFromData(ReceivedData{Data: data})
+	assert.Nil(t, err)
+	assert.Equal(t, 12, header.index)
+	assert.Equal(t, codecZstd, header.codec)
+	assert.Equal(t, []byte("data"), header.data)
+
+	header, err = readHeaderFromData(ReceivedData{Data: builder.CreateHeader(12, []byte("data"))})
+	assert.Nil(t, err)
+	assert.Equal(t, 12, header.index)
+	assert.Equal(t, byte(0), header.codec)
+}
+
+func TestReaderHeaderBuilder(t *testing.T) {
+	builder := NewReaderHeaderBuilder("dir/fake", 120001).WithChunk(60000)
+	assert.Nil(t, builder.Build())
+	assert.Equal(t, "fake", builder.GetFilename())
+	assert.Equal(t, int64(120001), builder.GetFileSize())
+	assert.Equal(t, 3, builder.GetBufferCount())
 }
 
 func Test_readHeaderFromData(t *testing.T) {
@@ -56,6 +84,7 @@ func Test_readHeaderFromData(t *testing.T) {
 			chrunk:   1234,
 			count:    1,
 			index:    1,
+			session:  "session1",
 			data:     []byte("data"),
 		},
 		wantErr: func(t assert.TestingT, err error, i ...interface{}) bool {
@@ -0,0 +1,401 @@
+package pkg
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+	"golang.org/x/net/ipv4"
+)
+
+const (
+	// MDNSService is the DNS-SD service type of the waiters
+	MDNSService = "_transfer._udp.local."
+	// MDNSAddress is the IPv4 multicast address of mDNS
+	MDNSAddress = "224.0.0.251:5353"
+
+	mdnsTTL = 120
+)
+
+// MDNSResponder advertises a waiter as a DNS-SD service, and answers the queries
+type MDNSResponder struct {
+	peer      Peer
+	address   string
+	outputDir string
+}
+
+// NewMDNSResponder creates an instance of MDNSResponder
+func NewMDNSResponder(peer Peer) *MDNSResponder {
+	return &MDNSResponder{
+		peer:      peer,
+		address:   MDNSAddress,
+		outputDir: ".",
+	}
+}
+
+// WithAddress sets the address to listen, it's the mDNS multicast address by default
+func (r *MDNSResponder) WithAddress(address string) *MDNSResponder {
+	r.address = address
+	return r
+}
+
+// WithOutputDir sets the directory which the waiter writes the files into, the free space is measured on it
+func (r *MDNSResponder) WithOutputDir(dir string) *MDNSResponder {
+	if dir != "" {
+		r.outputDir = dir
+	}
+	return r
+}
+
+// Start listens the queries and answers them until the context is done
+func (r *MDNSResponder) Start(ctx context.Context) (err error) {
+	var addr *net.UDPAddr
+	if addr, err = net.ResolveUDPAddr("udp4", r.address); err != nil {
+		return
+	}
+
+	var conn *net.UDPConn
+	if addr.IP.IsMulticast() {
+		if conn, err = net.ListenMulticastUDP("udp4", nil, addr); err == nil {
+			joinGroup(ipv4.NewPacketConn(conn), addr)
+		}
+	} else {
+		conn, err = net.ListenUDP("udp4", addr)
+	}
+	if err != nil {
+		return
+	}
+
+	go func() {
+		<-ctx.Done()
+		_ = conn.Close()
+	}()
+
+	if addr.IP.IsMulticast() {
+		// announce the service once it's ready
+		if data, err := r.response(0, nil); err == nil {
+			_, _ = conn.WriteToUDP(data, addr)
+		}
+	}
+
+	go func() {
+		message := make([]byte, 9000)
+		for {
+			n, remote, err := conn.ReadFromUDP(message)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				continue
+			}
+			r.answer(conn, message[:n], remote, addr)
+		}
+	}()
+	return
+}
+
+func (r *MDNSResponder) answer(conn *net.UDPConn, message []byte, remote, group *net.UDPAddr) {
+	parser := dnsmessage.Parser{}
+	header, err := parser.Start(message)
+	if err != nil || header.Response {
+		return
+	}
+
+	questions, err := parser.AllQuestions()
+	if err != nil {
+		return
+	}
+
+	instance := r.instance()
+	for _, q := range questions {
+		name := strings.ToLower(q.Name.String())
+		if name != MDNSService && name != strings.ToLower(instance) {
+			continue
+		}
+
+		// answer with unicast for the legacy queries and the ones which have the unicast-response bit
+		unicast := remote.Port != 5353 || q.Class&(1<<15) != 0
+		target := group
+		var echo []dnsmessage.Question
+		if unicast || !group.IP.IsMulticast() {
+			target = remote
+		}
+		if remote.Port != 5353 {
+			echo = questions
+		}
+
+		if data, err := r.response(header.ID, echo); err == nil {
+			_, _ = conn.WriteToUDP(data, target)
+		}
+		return
+	}
+}
+
+func (r *MDNSResponder) instance() string {
+	return dnsLabel(r.peer.Name) + "." + MDNSService
+}
+
+func (r *MDNSResponder) hostname() string {
+	return dnsLabel(r.peer.Hostname) + ".local."
+}
+
+func (r *MDNSResponder) response(id uint16, questions []dnsmessage.Question) (data []byte, err error) {
+	var service, instance, hostname dnsmessage.Name
+	if service, err = dnsmessage.NewName(MDNSService); err != nil {
+		return
+	}
+	if instance, err = dnsmessage.NewName(r.instance()); err != nil {
+		return
+	}
+	if hostname, err = dnsmessage.NewName(r.hostname()); err != nil {
+		return
+	}
+
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, Response: true, Authoritative: true})
+	builder.EnableCompression()
+	if err = builder.StartQuestions(); err != nil {
+		return
+	}
+	for _, q := range questions {
+		if err = builder.Question(q); err != nil {
+			return
+		}
+	}
+	if err = builder.StartAnswers(); err != nil {
+		return
+	}
+
+	resource := func(name dnsmessage.Name, resourceType dnsmessage.Type) dnsmessage.ResourceHeader {
+		return dnsmessage.ResourceHeader{Name: name, Type: resourceType, Class: dnsmessage.ClassINET, TTL: mdnsTTL}
+	}
+	if err = builder.PTRResource(resource(service, dnsmessage.TypePTR),
+		dnsmessage.PTRResource{PTR: instance}); err != nil {
+		return
+	}
+	if err = builder.SRVResource(resource(instance, dnsmessage.TypeSRV),
+		dnsmessage.SRVResource{Port: uint16(r.peer.Port), Target: hostname}); err != nil {
+		return
+	}
+	// the free space might change between the responses
+	peer := r.peer
+	peer.FreeSpace, _ = FreeSpace(r.outputDir)
+	if err = builder.TXTResource(resource(instance, dnsmessage.TypeTXT),
+		dnsmessage.TXTResource{TXT: peerTXT(peer)}); err != nil {
+		return
+	}
+	for _, ip := range localIPv4s() {
+		a := dnsmessage.AResource{}
+		copy(a.A[:], ip)
+		if err = builder.AResource(resource(hostname, dnsmessage.TypeA), a); err != nil {
+			return
+		}
+	}
+	data, err = builder.Finish()
+	return
+}
+
+// BrowseMDNS queries the waiters via the address periodically, and notify with a channel
+func BrowseMDNS(ctx context.Context, address string, waiter chan Peer) (err error) {
+	var addr *net.UDPAddr
+	if addr, err = net.ResolveUDPAddr("udp4", address); err != nil {
+		return
+	}
+
+	var query []byte
+	if query, err = mdnsQuery(); err != nil {
+		return
+	}
+
+	var conn *net.UDPConn
+	if conn, err = net.ListenUDP("udp4", &net.UDPAddr{}); err != nil {
+		return
+	}
+
+	go func() {
+		defer func() {
+			_ = conn.Close()
+		}()
+
+		message := make([]byte, 9000)
+		for {
+			// the legacy unicast query, the responders answer it directly
+			_, _ = conn.WriteToUDP(query, addr)
+
+			for deadline := time.Now().Add(3 * time.Second); time.Now().Before(deadline); {
+				select {
+				case <-ctx.Done():
+					return
+				default:
+				}
+
+				_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+				n, remote, err := conn.ReadFromUDP(message)
+				if err != nil {
+					continue
+				}
+
+				for _, peer := range parseMDNSResponse(message[:n], remote) {
+					select {
+					case waiter <- peer:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}
+	}()
+	return
+}
+
+func mdnsQuery() (data []byte, err error) {
+	var service dnsmessage.Name
+	if service, err = dnsmessage.NewName(MDNSService); err != nil {
+		return
+	}
+
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{})
+	if err = builder.StartQuestions(); err != nil {
+		return
+	}
+	if err = builder.Question(dnsmessage.Question{
+		Name:  service,
+		Type:  dnsmessage.TypePTR,
+		Class: dnsmessage.ClassINET,
+	}); err != nil {
+		return
+	}
+	data, err = builder.Finish()
+	return
+}
+
+// parseMDNSResponse parses the waiters from a response, the address of a waiter is the remote address
+func parseMDNSResponse(message []byte, remote *net.UDPAddr) (peers []Peer) {
+	msg := dnsmessage.Message{}
+	if err := msg.Unpack(message); err != nil || !msg.Response {
+		return
+	}
+
+	var instances []string
+	ports := map[string]int{}
+	txts := map[string][]string{}
+	// the records might be in the additional section as well
+	for _, resource := range append(msg.Answers, msg.Additionals...) {
+		name := strings.ToLower(resource.Header.Name.String())
+		switch body := resource.Body.(type) {
+		case *dnsmessage.PTRResource:
+			if name == MDNSService {
+				instances = append(instances, strings.ToLower(body.PTR.String()))
+			}
+		case *dnsmessage.SRVResource:
+			ports[name] = int(body.Port)
+		case *dnsmessage.TXTResource:
+			txts[name] = body.TXT
+		}
+	}
+
+	for _, instance := range instances {
+		peer := peerFromTXT(txts[instance], remote)
+		if port, ok := ports[instance]; ok {
+			peer.Port = port
+		}
+		peers = append(peers, peer)
+	}
+	return
+}
+
+func peerTXT(peer Peer) []string {
+	txt := []string{
+		"port=" + strconv.Itoa(peer.Port),
+		"version=" + strconv.Itoa(peer.Version),
+		"name=" + peer.Name,
+		"hostname=" + peer.Hostname,
+	}
+	if len(peer.Features) > 0 {
+		txt = append(txt, "features="+strings.Join(peer.Features, ","))
+	}
+	if peer.Group != "" {
+		txt = append(txt, "group="+peer.Group)
+	}
+	if peer.FreeSpace > 0 {
+		txt = append(txt, "freeSpace="+strconv.FormatUint(peer.FreeSpace, 10))
+	}
+	return txt
+}
+
+func peerFromTXT(txt []string, remote *net.UDPAddr) (peer Peer) {
+	for _, item := range txt {
+		pair := strings.SplitN(item, "=", 2)
+		if len(pair) != 2 {
+			continue
+		}
+
+		switch pair[0] {
+		case "port":
+			peer.Port, _ = strconv.Atoi(pair[1])
+		case "version":
+			peer.Version, _ = strconv.Atoi(pair[1])
+		case "name":
+			peer.Name = pair[1]
+		case "hostname":
+			peer.Hostname = pair[1]
+		case "features":
+			peer.Features = strings.Split(pair[1], ",")
+		case "group":
+			peer.Group = pair[1]
+		case "freeSpace":
+			peer.FreeSpace, _ = strconv.ParseUint(pair[1], 10, 64)
+		}
+	}
+
+	peer.IP = remote.IP.String()
+	if peer.Name == "" {
+		peer.Name = peer.Hostname
+	}
+	if peer.Name == "" {
+		peer.Name = peer.IP
+	}
+	peer.LastSeen = time.Now()
+	return
+}
+
+// dnsLabel makes sure the text could be a single DNS label
+func dnsLabel(text string) string {
+	if text = strings.ReplaceAll(text, ".", "-"); text == "" {
+		text = "transfer"
+	}
+	if len(text) > 63 {
+		text = text[:63]
+	}
+	return text
+}
+
+// joinGroup joins the multicast group on all the available interfaces
+func joinGroup(conn *ipv4.PacketConn, group *net.UDPAddr) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return
+	}
+
+	for i := range ifaces {
+		if ifaces[i].Flags&net.FlagUp != 0 && ifaces[i].Flags&net.FlagMulticast != 0 {
+			_ = conn.JoinGroup(&ifaces[i], group)
+		}
+	}
+}
+
+func localIPv4s() (ips []net.IP) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return
+	}
+
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && ipNet.IP.To4() != nil {
+			ips = append(ips, ipNet.IP.To4())
+		}
+	}
+	return
+}
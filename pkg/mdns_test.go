@@ -0,0 +1,66 @@
+package pkg
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMDNS(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.TODO(), 5*time.Second)
+	defer cancel()
+
+	address := freeUDPAddress(t)
+	peer := Peer{Name: "my.laptop", Hostname: "host", Port: 3001, Version: ProtocolVersion,
+		Features: []string{FeatureCompression}, Group: "team-a"}
+	err := NewMDNSResponder(peer).WithAddress(address).WithOutputDir(t.TempDir()).Start(ctx)
+	assert.Nil(t, err)
+
+	waiter := make(chan Peer, 10)
+	err = BrowseMDNS(ctx, address, waiter)
+	assert.Nil(t, err)
+
+	select {
+	case <-ctx.Done():
+		assert.Fail(t, "cannot find the waiter via mDNS")
+	case result := <-waiter:
+		assert.Equal(t, "my.laptop", result.Name)
+		assert.Equal(t, "host", result.Hostname)
+		assert.Equal(t, 3001, result.Port)
+		assert.Equal(t, ProtocolVersion, result.Version)
+		assert.Equal(t, []string{FeatureCompression}, result.Features)
+		assert.Equal(t, "team-a", result.Group)
+		assert.NotZero(t, result.FreeSpace)
+		assert.Equal(t, "127.0.0.1", result.IP)
+	}
+}
+
+func TestParseMDNSResponse(t *testing.T) {
+	remote := &net.UDPAddr{IP: net.ParseIP("192.168.1.2")}
+	assert.Empty(t, parseMDNSResponse([]byte("invalid"), remote))
+
+	// a query should be ignored
+	query, err := mdnsQuery()
+	assert.Nil(t, err)
+	assert.Empty(t, parseMDNSResponse(query, remote))
+
+	response, err := NewMDNSResponder(Peer{Port: 3000}).response(0, nil)
+	assert.Nil(t, err)
+	peers := parseMDNSResponse(response, remote)
+	if assert.Equal(t, 1, len(peers)) {
+		assert.Equal(t, "192.168.1.2", peers[0].Name)
+		assert.Equal(t, 3000, peers[0].Port)
+	}
+}
+
+func freeUDPAddress(t *testing.T) string {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	assert.Nil(t, err)
+	defer func() {
+		_ = conn.Close()
+	}()
+	return conn.LocalAddr().String()
+}
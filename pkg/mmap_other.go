@@ -0,0 +1,17 @@
+//go:build !linux && !darwin
+
+package pkg
+
+import (
+	"errors"
+	"os"
+)
+
+// mmapFile is not supported on this platform
+func mmapFile(*os.File, int64) ([]byte, error) {
+	return nil, errors.New("mmap is not supported")
+}
+
+func munmap([]byte) error {
+	return nil
+}
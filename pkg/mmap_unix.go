@@ -0,0 +1,24 @@
+//go:build linux || darwin
+
+package pkg
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"syscall"
+)
+
+// mmapFile maps the whole file into the memory as read only
+func mmapFile(f *os.File, size int64) (data []byte, err error) {
+	if size > math.MaxInt {
+		err = fmt.Errorf("the file is too large to be mapped, size: %d", size)
+		return
+	}
+	data, err = syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	return
+}
+
+func munmap(data []byte) error {
+	return syscall.Munmap(data)
+}
@@ -0,0 +1,78 @@
+//go:build linux
+
+package pkg
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+// batchSupported means the batch syscalls sendmmsg and recvmmsg are available
+const batchSupported = true
+
+// the socket options from linux/udp.h
+const (
+	udpSegment = 103
+	udpGRO     = 104
+)
+
+// groControlSize is able to hold the control message of GRO
+var groControlSize = syscall.CmsgSpace(4)
+
+// enableGSO checks if the kernel supports UDP generic segmentation offload
+func enableGSO(conn *net.UDPConn) (ok bool) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return
+	}
+	_ = raw.Control(func(fd uintptr) {
+		_, err = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_UDP, udpSegment)
+		ok = err == nil
+	})
+	return
+}
+
+// enableGRO asks the kernel to coalesce the datagrams with UDP generic receive offload
+func enableGRO(conn *net.UDPConn) (ok bool) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return
+	}
+	_ = raw.Control(func(fd uintptr) {
+		ok = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_UDP, udpGRO, 1) == nil
+	})
+	return
+}
+
+// gsoControl creates the control message which sets the segment size
+func gsoControl(size int) []byte {
+	control := make([]byte, syscall.CmsgSpace(2))
+	header := (*syscall.Cmsghdr)(unsafe.Pointer(&control[0]))
+	header.Level = syscall.IPPROTO_UDP
+	header.Type = udpSegment
+	header.SetLen(syscall.CmsgLen(2))
+	binary.NativeEndian.PutUint16(control[syscall.CmsgLen(0):], uint16(size))
+	return control
+}
+
+// gsoFailed checks if the error is caused by GSO
+func gsoFailed(err error) bool {
+	return errors.Is(err, syscall.EIO) || errors.Is(err, syscall.EINVAL)
+}
+
+// groSegmentSize returns the size of the coalesced datagrams, it's 0 if they were not coalesced
+func groSegmentSize(control []byte) int {
+	messages, err := syscall.ParseSocketControlMessage(control)
+	if err != nil {
+		return 0
+	}
+	for _, message := range messages {
+		if message.Header.Level == syscall.IPPROTO_UDP && message.Header.Type == udpGRO && len(message.Data) >= 4 {
+			return int(binary.NativeEndian.Uint32(message.Data))
+		}
+	}
+	return 0
+}
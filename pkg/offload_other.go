@@ -0,0 +1,33 @@
+//go:build !linux
+
+package pkg
+
+import "net"
+
+// batchSupported means the batch syscalls sendmmsg and recvmmsg are available
+const batchSupported = false
+
+// groControlSize is able to hold the control message of GRO
+var groControlSize = 0
+
+// enableGSO is only supported on Linux
+func enableGSO(*net.UDPConn) bool {
+	return false
+}
+
+// enableGRO is only supported on Linux
+func enableGRO(*net.UDPConn) bool {
+	return false
+}
+
+func gsoControl(int) []byte {
+	return nil
+}
+
+func gsoFailed(error) bool {
+	return false
+}
+
+func groSegmentSize([]byte) int {
+	return 0
+}
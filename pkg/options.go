@@ -0,0 +1,129 @@
+package pkg
+
+import (
+	"net"
+	"time"
+)
+
+// Option configures a Client or a Server, the ones which do not apply are ignored, such as WithQuota for a Client
+type Option func(*options)
+
+// options are the settings of a Client or a Server, they are applied to a sender or a waiter of each session
+type options struct {
+	transport   Transport
+	parallel    int
+	secret      string
+	idleTimeout time.Duration
+	timeout     time.Duration
+	chunk       int
+	compress    string
+	delta       bool
+	rate        int64
+	quota       int64
+	trusted     []*net.IPNet
+}
+
+func newOptions(opts []Option) (o options) {
+	o = options{
+		transport:   &UDPTransport{},
+		parallel:    1,
+		idleTimeout: DefaultIdleTimeout,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return
+}
+
+// WithTransport sets the transport, it's UDP by default. Both sides should use the same one.
+func WithTransport(transport Transport) Option {
+	return func(o *options) {
+		o.transport = transport
+	}
+}
+
+// WithParallel sets the count of the ports, they start from the port of the address one by one.
+// The server should listen to the same count of the ports at least.
+func WithParallel(parallel int) Option {
+	return func(o *options) {
+		o.parallel = parallel
+	}
+}
+
+// WithSecret sets the shared secret, the client signs the session with it and the server verifies it
+func WithSecret(secret string) Option {
+	return func(o *options) {
+		o.secret = secret
+	}
+}
+
+// WithIdleTimeout fails the session if there is nothing from the peer in the duration, zero means no limit
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.idleTimeout = timeout
+	}
+}
+
+// WithTimeout fails the session if it takes longer than the duration, zero means no limit
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// WithChunk sets the size of the data in each datagram of a Client, the default one depends on the OS if it's zero
+func WithChunk(chunk int) Option {
+	return func(o *options) {
+		o.chunk = chunk
+	}
+}
+
+// WithCompress compresses each chunk of a Client with zstd or lz4
+func WithCompress(compress string) Option {
+	return func(o *options) {
+		o.compress = compress
+	}
+}
+
+// WithDelta makes a Client send the chunks which are different from the existing file of the server only,
+// see Incoming.SaveFile
+func WithDelta(delta bool) Option {
+	return func(o *options) {
+		o.delta = delta
+	}
+}
+
+// WithRate limits the sending rate of a Client in bytes per second, it's not limited if it's zero
+func WithRate(rate int64) Option {
+	return func(o *options) {
+		o.rate = rate
+	}
+}
+
+// WithTrustedPeers makes a Server accept the offers from the networks only, see ParseTrustedPeers
+func WithTrustedPeers(trusted []*net.IPNet) Option {
+	return func(o *options) {
+		o.trusted = trusted
+	}
+}
+
+// WithQuota sets the maximum size of a file which a Server accepts, it's not limited if it's zero
+func WithQuota(quota int64) Option {
+	return func(o *options) {
+		o.quota = quota
+	}
+}
+
+// sender creates a sender with the options
+func (o options) sender(ip string, port int) *UDPSender {
+	return NewUDPSender(ip).WithPort(port).WithTransport(o.transport).WithParallel(o.parallel).
+		WithSecret(o.secret).WithIdleTimeout(o.idleTimeout).WithTimeout(o.timeout).
+		WithChunk(o.chunk).WithCompress(o.compress).WithDelta(o.delta).WithRate(o.rate)
+}
+
+// waiter creates a waiter with the options
+func (o options) waiter(listen string, port int) *UDPWaiter {
+	return NewUDPWaiter(port).ListenAddress(listen).WithTransport(o.transport).WithParallel(o.parallel).
+		WithSecret(o.secret).WithIdleTimeout(o.idleTimeout).WithTimeout(o.timeout).WithQuota(o.quota).
+		WithTrustedPeers(o.trusted)
+}
@@ -0,0 +1,349 @@
+package pkg
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// packet is a frame with its remote address
+type packet struct {
+	data []byte
+	addr net.Addr
+	conn net.PacketConn
+	// buffer holds the data if it's taken from a ring
+	buffer *receiveBuffer
+}
+
+// packetQueue holds the frames which are read by the background goroutines, and supports the read deadline
+type packetQueue struct {
+	packets   chan packet
+	closed    chan struct{}
+	closeOnce sync.Once
+	deadline  atomic.Value
+}
+
+func newPacketQueue() *packetQueue {
+	return &packetQueue{
+		packets: make(chan packet, 1024),
+		closed:  make(chan struct{}),
+	}
+}
+
+func (q *packetQueue) push(p packet) bool {
+	select {
+	case q.packets <- p:
+		return true
+	case <-q.closed:
+		return false
+	}
+}
+
+// pop takes a frame, the deadline changes take effect in the next call
+func (q *packetQueue) pop() (p packet, err error) {
+	var timeout <-chan time.Time
+	if deadline, ok := q.deadline.Load().(time.Time); ok && !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case p = <-q.packets:
+	case <-timeout:
+		err = os.ErrDeadlineExceeded
+	case <-q.closed:
+		err = net.ErrClosed
+	}
+	return
+}
+
+func (q *packetQueue) setDeadline(t time.Time) {
+	q.deadline.Store(t)
+}
+
+func (q *packetQueue) close() {
+	q.closeOnce.Do(func() {
+		close(q.closed)
+	})
+}
+
+// frameHeaderLength is the length of the frame size in a stream
+const frameHeaderLength = 10
+
+func writeFrame(writer io.Writer, data []byte) (err error) {
+	_, err = writer.Write(append([]byte(fillContainerWithNumber(len(data), frameHeaderLength)), data...))
+	return
+}
+
+func readFrame(reader io.Reader) (data []byte, err error) {
+	header := make([]byte, frameHeaderLength)
+	if _, err = io.ReadFull(reader, header); err != nil {
+		return
+	}
+
+	// a frame is never bigger than a datagram, it's not allocated if the peer claims a huge one
+	var length int
+	if length, err = strconv.Atoi(strings.TrimSpace(string(header))); err != nil || length < 0 || length > maxDatagramSize {
+		err = fmt.Errorf("invalid frame length: '%s'", string(header))
+		return
+	}
+	data = make([]byte, length)
+	_, err = io.ReadFull(reader, data)
+	return
+}
+
+// framedConn keeps the frame boundaries over a stream connection
+type framedConn struct {
+	net.Conn
+	queue *packetQueue
+	lock  sync.Mutex
+}
+
+func newFramedConn(conn net.Conn) *framedConn {
+	c := &framedConn{Conn: conn, queue: newPacketQueue()}
+	go func() {
+		defer c.queue.close()
+		for {
+			data, err := readFrame(conn)
+			if err != nil || !c.queue.push(packet{data: data}) {
+				return
+			}
+		}
+	}()
+	return c
+}
+
+// Read reads a whole frame, the rest part of it will be dropped if the buffer is not big enough
+func (c *framedConn) Read(p []byte) (n int, err error) {
+	var frame packet
+	if frame, err = c.queue.pop(); err == nil {
+		n = copy(p, frame.data)
+	} else if err == net.ErrClosed {
+		err = io.EOF
+	}
+	return
+}
+
+// Write writes a whole frame
+func (c *framedConn) Write(p []byte) (n int, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err = writeFrame(c.Conn, p); err == nil {
+		n = len(p)
+	}
+	return
+}
+
+// SetDeadline sets the read and write deadlines
+func (c *framedConn) SetDeadline(t time.Time) error {
+	c.queue.setDeadline(t)
+	return c.Conn.SetWriteDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline
+func (c *framedConn) SetReadDeadline(t time.Time) error {
+	c.queue.setDeadline(t)
+	return nil
+}
+
+// Close closes the connection
+func (c *framedConn) Close() error {
+	c.queue.close()
+	return c.Conn.Close()
+}
+
+// streamPacketConn accepts the stream connections, and reads the frames from all of them
+type streamPacketConn struct {
+	listener net.Listener
+	queue    *packetQueue
+	conns    sync.Map
+	// writeLock keeps the frames from different goroutines in order
+	writeLock sync.Mutex
+}
+
+func newStreamPacketConn(listener net.Listener) *streamPacketConn {
+	c := &streamPacketConn{listener: listener, queue: newPacketQueue()}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			c.conns.Store(conn.RemoteAddr().String(), conn)
+			go c.read(conn)
+		}
+	}()
+	return c
+}
+
+func (c *streamPacketConn) read(conn net.Conn) {
+	defer func() {
+		c.conns.Delete(conn.RemoteAddr().String())
+		_ = conn.Close()
+	}()
+
+	for {
+		data, err := readFrame(conn)
+		if err != nil || !c.queue.push(packet{data: data, addr: conn.RemoteAddr()}) {
+			return
+		}
+	}
+}
+
+// ReadFrom reads a whole frame from any connection
+func (c *streamPacketConn) ReadFrom(p []byte) (n int, addr net.Addr, err error) {
+	var frame packet
+	if frame, err = c.queue.pop(); err == nil {
+		n, addr = copy(p, frame.data), frame.addr
+	}
+	return
+}
+
+// WriteTo writes a whole frame to the connection of the address
+func (c *streamPacketConn) WriteTo(p []byte, addr net.Addr) (n int, err error) {
+	conn, ok := c.conns.Load(addr.String())
+	if !ok {
+		err = fmt.Errorf("no connection from %s", addr.String())
+		return
+	}
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	if err = writeFrame(conn.(net.Conn), p); err == nil {
+		n = len(p)
+	}
+	return
+}
+
+// Close closes the listener and all the connections
+func (c *streamPacketConn) Close() (err error) {
+	c.queue.close()
+	err = c.listener.Close()
+	c.conns.Range(func(_, conn interface{}) bool {
+		_ = conn.(net.Conn).Close()
+		return true
+	})
+	return
+}
+
+// LocalAddr returns the listen address
+func (c *streamPacketConn) LocalAddr() net.Addr {
+	return c.listener.Addr()
+}
+
+// SetDeadline sets the read deadline only
+func (c *streamPacketConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline
+func (c *streamPacketConn) SetReadDeadline(t time.Time) error {
+	c.queue.setDeadline(t)
+	return nil
+}
+
+// SetWriteDeadline is not supported
+func (c *streamPacketConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+// multiBufferCount is the count of the receive buffers which are shared by the connections of a multiPacketConn
+const multiBufferCount = 256
+
+// multiPacketConn reads the frames from multiple connections,
+// and writes the frame back through the connection which the remote address came from
+type multiPacketConn struct {
+	conns   []net.PacketConn
+	queue   *packetQueue
+	remotes sync.Map
+}
+
+func newMultiPacketConn(conns ...net.PacketConn) *multiPacketConn {
+	c := &multiPacketConn{conns: conns, queue: newPacketQueue()}
+	ring := newBufferRing(multiBufferCount, maxDatagramSize)
+	for _, conn := range conns {
+		go func(conn net.PacketConn) {
+			reader := newFrameReader(conn, ring)
+			for {
+				frames, err := reader.read()
+				if err != nil {
+					if ne, ok := err.(net.Error); ok && ne.Timeout() {
+						continue
+					}
+					return
+				}
+				for _, frame := range frames {
+					if !c.queue.push(packet{data: frame.Data, addr: frame.Remote, conn: conn, buffer: frame.buffer}) {
+						frame.release()
+						return
+					}
+				}
+			}
+		}(conn)
+	}
+	return c
+}
+
+// ReadFrom reads a whole frame from any connection
+func (c *multiPacketConn) ReadFrom(p []byte) (n int, addr net.Addr, err error) {
+	var frame packet
+	if frame, err = c.queue.pop(); err == nil {
+		c.remotes.Store(frame.addr.Network()+frame.addr.String(), frame.conn)
+		n, addr = copy(p, frame.data), frame.addr
+		frame.buffer.release()
+	}
+	return
+}
+
+// WriteTo writes a whole frame through the connection which the address came from
+func (c *multiPacketConn) WriteTo(p []byte, addr net.Addr) (n int, err error) {
+	conn, ok := c.remotes.Load(addr.Network() + addr.String())
+	if !ok {
+		err = fmt.Errorf("unknown remote address %s", addr.String())
+		return
+	}
+	return conn.(net.PacketConn).WriteTo(p, addr)
+}
+
+// Close closes all the connections
+func (c *multiPacketConn) Close() (err error) {
+	c.queue.close()
+	for _, conn := range c.conns {
+		if closeErr := conn.Close(); closeErr != nil {
+			err = closeErr
+		}
+	}
+	return
+}
+
+// LocalAddr returns the address of the first connection
+func (c *multiPacketConn) LocalAddr() net.Addr {
+	return c.conns[0].LocalAddr()
+}
+
+// SetDeadline sets the read deadline only
+func (c *multiPacketConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline
+func (c *multiPacketConn) SetReadDeadline(t time.Time) error {
+	c.queue.setDeadline(t)
+	return nil
+}
+
+// SetWriteDeadline sets the write deadline of all the connections
+func (c *multiPacketConn) SetWriteDeadline(t time.Time) (err error) {
+	for _, conn := range c.conns {
+		if setErr := conn.SetWriteDeadline(t); setErr != nil {
+			err = setErr
+		}
+	}
+	return
+}
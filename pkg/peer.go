@@ -0,0 +1,247 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProtocolVersion is the version of the transfer protocol which current build speaks
+const ProtocolVersion = 3
+
+// the features which a peer might support
+const (
+	FeatureEncryption  = "encryption"
+	FeatureCompression = "compression"
+	FeatureFEC         = "fec"
+	FeatureDelta       = "delta"
+)
+
+// announcementPrefix is the leading bytes of an announcement,
+// the legacy waiters send the prefix only
+const announcementPrefix = "hello"
+
+// defaultDataPort is the data port of the legacy waiters
+const defaultDataPort = 3000
+
+// DefaultDiscoveryPort is the UDP port of the announcements
+const DefaultDiscoveryPort = 9981
+
+// Peer represents a waiter which announced itself in the network
+type Peer struct {
+	Hostname  string   `json:"hostname"`
+	Name      string   `json:"name"`
+	Port      int      `json:"port"`
+	Version   int      `json:"version"`
+	Features  []string `json:"features,omitempty"`
+	FreeSpace uint64   `json:"freeSpace"`
+	// Group is the discovery group of the waiter, the senders find the waiters of the same group only.
+	// It's the default group if it's empty, the legacy waiters are in it.
+	Group string `json:"group,omitempty"`
+
+	// IP is the address which the announcement came from
+	IP string `json:"-"`
+	// LastSeen is the time of receiving the announcement
+	LastSeen time.Time `json:"-"`
+}
+
+// NewLocalPeer creates the announcement of current machine, it has the features which this build supports
+func NewLocalPeer(name string, port int) (peer Peer) {
+	peer = Peer{
+		Name:     name,
+		Port:     port,
+		Version:  ProtocolVersion,
+		Features: append([]string(nil), supportedFeatures...),
+	}
+	peer.Hostname, _ = os.Hostname()
+	if peer.Name == "" {
+		peer.Name = peer.Hostname
+	}
+	return
+}
+
+// Address returns the data address of the peer
+func (p Peer) Address() string {
+	return net.JoinHostPort(p.IP, strconv.Itoa(p.Port))
+}
+
+// Supports checks if the peer supports the specific feature
+func (p Peer) Supports(feature string) bool {
+	for _, f := range p.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches checks if the peer has the name, hostname or IP address
+func (p Peer) Matches(name string) bool {
+	return p.Name == name || p.Hostname == name || p.IP == name
+}
+
+// Marshal encodes the peer as an announcement
+func (p Peer) Marshal() (data []byte, err error) {
+	var payload []byte
+	if payload, err = json.Marshal(p); err == nil {
+		data = append([]byte(announcementPrefix), payload...)
+	}
+	return
+}
+
+// ParsePeer parses the announcement which comes from the remote address
+func ParsePeer(data []byte, remote *net.UDPAddr) (peer Peer, err error) {
+	message := string(data)
+	if !strings.HasPrefix(message, announcementPrefix) {
+		err = fmt.Errorf("invalid announcement: '%s'", message)
+		return
+	}
+
+	if payload := strings.TrimPrefix(message, announcementPrefix); payload == "" {
+		// the legacy waiter has nothing but the prefix
+		peer.Port = defaultDataPort
+	} else if err = json.Unmarshal([]byte(payload), &peer); err != nil {
+		err = fmt.Errorf("invalid announcement: %v", err)
+		return
+	}
+
+	if remote != nil {
+		peer.IP = remote.IP.String()
+		if remote.Zone != "" {
+			// the zone is required to connect to an IPv6 link-local address
+			peer.IP += "%" + remote.Zone
+		}
+	}
+	if peer.Name == "" {
+		peer.Name = peer.Hostname
+	}
+	if peer.Name == "" {
+		peer.Name = peer.IP
+	}
+	peer.LastSeen = time.Now()
+	return
+}
+
+// Peers holds the discovered peers, the later announcement replaces the former one
+type Peers struct {
+	sync.Mutex
+	data map[string]Peer
+}
+
+// NewPeers creates an instance of Peers
+func NewPeers() *Peers {
+	return &Peers{data: map[string]Peer{}}
+}
+
+// Put adds or refreshes a peer
+func (p *Peers) Put(peer Peer) {
+	p.Lock()
+	defer p.Unlock()
+	p.data[peer.Address()] = peer
+}
+
+// List returns all the peers which are sorted by name and address
+func (p *Peers) List() (peers []Peer) {
+	p.Lock()
+	defer p.Unlock()
+	for _, peer := range p.data {
+		peers = append(peers, peer)
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		if peers[i].Name != peers[j].Name {
+			return peers[i].Name < peers[j].Name
+		}
+		return peers[i].Address() < peers[j].Address()
+	})
+	return
+}
+
+// Find returns the peer which has the name, hostname or IP address
+func (p *Peers) Find(name string) (peer Peer, ok bool) {
+	for _, item := range p.List() {
+		if item.Matches(name) {
+			peer, ok = item, true
+			return
+		}
+	}
+	return
+}
+
+// Size returns the count of the peers
+func (p *Peers) Size() int {
+	p.Lock()
+	defer p.Unlock()
+	return len(p.data)
+}
+
+// Discovery is the scope of finding the waiters, the zero value is the default port and group
+type Discovery struct {
+	// Port is the UDP port of the announcements, it's DefaultDiscoveryPort if it's zero
+	Port int
+	// Group is the discovery group of the waiters to find
+	Group string
+}
+
+// port returns the port of the announcements
+func (d Discovery) port() int {
+	if d.Port > 0 {
+		return d.Port
+	}
+	return DefaultDiscoveryPort
+}
+
+// DiscoverPeers collects the peers of the default port and group until timeout
+func DiscoverPeers(ctx context.Context, timeout time.Duration) (peers *Peers) {
+	return Discovery{}.DiscoverPeers(ctx, timeout)
+}
+
+// DiscoverPeers collects the peers until timeout
+func (d Discovery) DiscoverPeers(ctx context.Context, timeout time.Duration) (peers *Peers) {
+	peers = NewPeers()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	waiter := make(chan Peer, 10)
+	d.FindWaiters(ctx, waiter)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case peer := <-waiter:
+			peers.Put(peer)
+		}
+	}
+}
+
+// FindPeer waits for the peer of the default port and group which has the name, hostname or IP address
+func FindPeer(ctx context.Context, timeout time.Duration, name string) (peer Peer, err error) {
+	return Discovery{}.FindPeer(ctx, timeout, name)
+}
+
+// FindPeer waits for the peer which has the name, hostname or IP address
+func (d Discovery) FindPeer(ctx context.Context, timeout time.Duration, name string) (peer Peer, err error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	waiter := make(chan Peer, 10)
+	d.FindWaiters(ctx, waiter)
+	for {
+		select {
+		case <-ctx.Done():
+			peer = Peer{}
+			err = fmt.Errorf("%w: cannot find '%s' in %v", ErrPeerNotFound, name, timeout)
+			return
+		case peer = <-waiter:
+			if peer.Matches(name) {
+				return
+			}
+		}
+	}
+}
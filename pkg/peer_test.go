@@ -0,0 +1,106 @@
+package pkg
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPeer(t *testing.T) {
+	peer := NewLocalPeer("", 3001)
+	assert.Equal(t, ProtocolVersion, peer.Version)
+	assert.Equal(t, peer.Hostname, peer.Name)
+	assert.True(t, peer.Supports(FeatureCompression))
+	assert.True(t, peer.Supports(FeatureDelta))
+	assert.False(t, peer.Supports(FeatureEncryption))
+
+	peer.Name = "laptop"
+	peer.Features = []string{FeatureCompression}
+	peer.FreeSpace = 1024
+	peer.Group = "team-a"
+	data, err := peer.Marshal()
+	assert.Nil(t, err)
+
+	remote := &net.UDPAddr{IP: net.ParseIP("192.168.1.2"), Port: 9981}
+	result, err := ParsePeer(data, remote)
+	assert.Nil(t, err)
+	assert.Equal(t, "laptop", result.Name)
+	assert.Equal(t, peer.Hostname, result.Hostname)
+	assert.Equal(t, 3001, result.Port)
+	assert.Equal(t, uint64(1024), result.FreeSpace)
+	assert.Equal(t, "team-a", result.Group)
+	assert.Equal(t, "192.168.1.2", result.IP)
+	assert.Equal(t, "192.168.1.2:3001", result.Address())
+	assert.False(t, result.LastSeen.IsZero())
+	assert.True(t, result.Supports(FeatureCompression))
+	assert.False(t, result.Supports(FeatureFEC))
+
+	// link-local IPv6 address
+	remote = &net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: 9981, Zone: "eth0"}
+	result, err = ParsePeer(data, remote)
+	assert.Nil(t, err)
+	assert.Equal(t, "fe80::1%eth0", result.IP)
+	assert.Equal(t, "[fe80::1%eth0]:3001", result.Address())
+}
+
+func TestParsePeer(t *testing.T) {
+	remote := &net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: 9981}
+	tests := []struct {
+		name     string
+		data     []byte
+		wantPeer Peer
+		wantErr  bool
+	}{{
+		name:     "legacy announcement",
+		data:     []byte("hello"),
+		wantPeer: Peer{Name: "fe80::1", Port: 3000, IP: "fe80::1"},
+	}, {
+		name:     "without name",
+		data:     []byte(`hello{"hostname":"host","port":3002,"version":1}`),
+		wantPeer: Peer{Name: "host", Hostname: "host", Port: 3002, Version: 1, IP: "fe80::1"},
+	}, {
+		name:    "unknown message",
+		data:    []byte("miss0000000001"),
+		wantErr: true,
+	}, {
+		name:    "invalid payload",
+		data:    []byte("hello{"),
+		wantErr: true,
+	}}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			peer, err := ParsePeer(tt.data, remote)
+			if tt.wantErr {
+				assert.NotNil(t, err, "failed in case [%d]", i)
+				return
+			}
+			assert.Nil(t, err, "failed in case [%d]", i)
+			peer.LastSeen = tt.wantPeer.LastSeen
+			assert.Equal(t, tt.wantPeer, peer, "failed in case [%d]", i)
+			assert.Equal(t, "[fe80::1]:"+fillContainerWithNumber(tt.wantPeer.Port, 0), peer.Address())
+		})
+	}
+}
+
+func TestPeers(t *testing.T) {
+	peers := NewPeers()
+	assert.Equal(t, 0, peers.Size())
+
+	peers.Put(Peer{Name: "b", IP: "192.168.1.3", Port: 3000})
+	peers.Put(Peer{Name: "a", Hostname: "host-a", IP: "192.168.1.2", Port: 3000})
+	peers.Put(Peer{Name: "b", IP: "192.168.1.3", Port: 3000, FreeSpace: 10})
+	assert.Equal(t, 2, peers.Size())
+
+	list := peers.List()
+	assert.Equal(t, "a", list[0].Name)
+	assert.Equal(t, uint64(10), list[1].FreeSpace)
+
+	for _, name := range []string{"a", "host-a", "192.168.1.2"} {
+		peer, ok := peers.Find(name)
+		assert.True(t, ok)
+		assert.Equal(t, "a", peer.Name)
+	}
+	_, ok := peers.Find("c")
+	assert.False(t, ok)
+}
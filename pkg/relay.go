@@ -0,0 +1,206 @@
+package pkg
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the roles of the relay clients
+const (
+	relayRoleSender = "send"
+	relayRoleWaiter = "wait"
+)
+
+// the frames between the relay server and the clients
+const (
+	// relayRegister is sent by a client with its role and the session code, like: rgst wait code
+	relayRegister = "rgst"
+	// relayRegistered is the answer of a registration
+	relayRegistered = "rgok"
+	// relayBusy is the answer of a registration if the session code is paired already
+	relayBusy = "busy"
+	// relayPeer tells a client the public address of the other one, like: peer 1.2.3.4:5678
+	relayPeer = "peer"
+	// relayForward is the prefix of the frames which are forwarded by the relay server
+	relayForward = "fwrd"
+	// relayPunch and relayPunched are sent between the clients directly for the UDP hole punching
+	relayPunch   = "pnch"
+	relayPunched = "pnok"
+)
+
+// DefaultRelayPort is the default port of the relay server
+const DefaultRelayPort = 9982
+
+// RelayServer introduces the sender and the waiter which have the same session code to each other,
+// and forwards the frames between them if they could not connect directly.
+// A session code has one pair only, the other clients are rejected until one of the pair expires.
+type RelayServer struct {
+	address string
+	expire  time.Duration
+
+	conn    *net.UDPConn
+	clients map[string]*relayClientInfo
+	lock    sync.Mutex
+}
+
+// relayClientInfo is a registered client
+type relayClientInfo struct {
+	code     string
+	role     string
+	addr     *net.UDPAddr
+	lastSeen time.Time
+	// peer is the other client of the pair, it's nil until both roles registered
+	peer *relayClientInfo
+}
+
+// NewRelayServer creates an instance of RelayServer
+func NewRelayServer(address string) *RelayServer {
+	return &RelayServer{
+		address: address,
+		expire:  30 * time.Second,
+		clients: map[string]*relayClientInfo{},
+	}
+}
+
+// Start listens to the clients until the context is done
+func (r *RelayServer) Start(ctx context.Context) (err error) {
+	var addr *net.UDPAddr
+	if addr, err = net.ResolveUDPAddr("udp", r.address); err != nil {
+		return
+	}
+	if r.conn, err = net.ListenUDP("udp", addr); err != nil {
+		return
+	}
+
+	go func() {
+		<-ctx.Done()
+		_ = r.conn.Close()
+	}()
+
+	go func() {
+		message := make([]byte, 65507)
+		for {
+			n, remote, err := r.conn.ReadFromUDP(message)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				continue
+			}
+			r.handle(message[:n], remote)
+		}
+	}()
+	return
+}
+
+// Addr returns the listen address
+func (r *RelayServer) Addr() net.Addr {
+	return r.conn.LocalAddr()
+}
+
+func (r *RelayServer) handle(message []byte, remote *net.UDPAddr) {
+	if len(message) < 4 {
+		return
+	}
+
+	switch string(message[:4]) {
+	case relayRegister:
+		fields := strings.Fields(string(message[4:]))
+		if len(fields) != 2 || (fields[0] != relayRoleSender && fields[0] != relayRoleWaiter) {
+			return
+		}
+		r.register(fields[0], fields[1], remote)
+	case relayForward:
+		if peer := r.peerOf(remote); peer != nil {
+			_, _ = r.conn.WriteToUDP(message, peer)
+		}
+	}
+}
+
+func (r *RelayServer) register(role, code string, remote *net.UDPAddr) {
+	r.lock.Lock()
+	r.removeExpired()
+	client, ok := r.clients[remote.String()]
+	if !ok || client.code != code || client.role != role {
+		if ok {
+			// the address registers another session
+			client.unpair()
+		}
+		if r.paired(code) {
+			r.lock.Unlock()
+			_, _ = r.conn.WriteToUDP([]byte(relayBusy), remote)
+			return
+		}
+		client = &relayClientInfo{code: code, role: role, addr: remote}
+		r.clients[remote.String()] = client
+	}
+	client.lastSeen = time.Now()
+	if client.peer == nil {
+		if client.peer = r.waiting(client); client.peer != nil {
+			client.peer.peer = client
+		}
+	}
+	peer := client.peer
+	r.lock.Unlock()
+
+	_, _ = r.conn.WriteToUDP([]byte(relayRegistered), remote)
+
+	// introduce the clients to each other, they will try the hole punching
+	if peer != nil {
+		_, _ = r.conn.WriteToUDP([]byte(relayPeer+" "+peer.addr.String()), remote)
+		_, _ = r.conn.WriteToUDP([]byte(relayPeer+" "+remote.String()), peer.addr)
+	}
+}
+
+// peerOf returns the address of the other client of the pair, it's nil if the client is not paired
+func (r *RelayServer) peerOf(remote *net.UDPAddr) (peer *net.UDPAddr) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if client, ok := r.clients[remote.String()]; ok && client.peer != nil {
+		peer = client.peer.addr
+	}
+	return
+}
+
+// paired checks if the session code has a pair already
+func (r *RelayServer) paired(code string) bool {
+	for _, item := range r.clients {
+		if item.code == code && item.peer != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// waiting returns the latest client which has the same session code but a different role, and is not paired
+func (r *RelayServer) waiting(client *relayClientInfo) (other *relayClientInfo) {
+	for _, item := range r.clients {
+		if item.code == client.code && item.role != client.role && item.peer == nil &&
+			(other == nil || item.lastSeen.After(other.lastSeen)) {
+			other = item
+		}
+	}
+	return
+}
+
+// removeExpired removes the clients which did not register again in time, the other one of a pair is free then
+func (r *RelayServer) removeExpired() {
+	for key, client := range r.clients {
+		if time.Since(client.lastSeen) > r.expire {
+			client.unpair()
+			delete(r.clients, key)
+		}
+	}
+}
+
+// unpair breaks the pair of the client
+func (c *relayClientInfo) unpair() {
+	if c.peer != nil {
+		c.peer.peer = nil
+		c.peer = nil
+	}
+}
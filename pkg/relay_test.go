@@ -0,0 +1,127 @@
+package pkg
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRelayTransport(t *testing.T) {
+	tests := []struct {
+		name         string
+		punchTimeout time.Duration
+		wantDirect   bool
+	}{{
+		name:         "hole punching",
+		punchTimeout: 3 * time.Second,
+		wantDirect:   true,
+	}, {
+		name:         "forwarded by the relay",
+		punchTimeout: 0,
+		wantDirect:   false,
+	}}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			relay := NewRelayServer("127.0.0.1:0")
+			assert.Nil(t, relay.Start(ctx), "failed in case [%d]", i)
+
+			transport := &RelayTransport{
+				Relay:        relay.Addr().String(),
+				Code:         "code",
+				PunchTimeout: tt.punchTimeout,
+				PeerTimeout:  3 * time.Second,
+			}
+			server, err := transport.Listen("")
+			assert.Nil(t, err, "failed in case [%d]", i)
+			defer func() {
+				_ = server.Close()
+			}()
+
+			client, err := transport.Dial("")
+			if !assert.Nil(t, err, "failed in case [%d]", i) {
+				return
+			}
+			defer func() {
+				_ = client.Close()
+			}()
+			assert.Equal(t, tt.wantDirect, client.(*relayConn).direct.Load(), "failed in case [%d]", i)
+
+			_, err = client.Write([]byte("hello"))
+			assert.Nil(t, err, "failed in case [%d]", i)
+
+			message := make([]byte, 1024)
+			_ = server.SetReadDeadline(time.Now().Add(3 * time.Second))
+			n, remote, err := server.ReadFrom(message)
+			assert.Nil(t, err, "failed in case [%d]", i)
+			assert.Equal(t, "hello", string(message[:n]), "failed in case [%d]", i)
+
+			_, err = server.WriteTo([]byte("done"), remote)
+			assert.Nil(t, err, "failed in case [%d]", i)
+			_ = client.SetReadDeadline(time.Now().Add(3 * time.Second))
+			n, err = client.Read(message)
+			assert.Nil(t, err, "failed in case [%d]", i)
+			assert.Equal(t, "done", string(message[:n]), "failed in case [%d]", i)
+		})
+	}
+}
+
+func TestRelayTransportWithoutWaiter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	relay := NewRelayServer("127.0.0.1:0")
+	assert.Nil(t, relay.Start(ctx))
+
+	transport := &RelayTransport{Relay: relay.Addr().String(), Code: "none", PeerTimeout: 200 * time.Millisecond}
+	_, err := transport.Dial("")
+	assert.NotNil(t, err)
+}
+
+func TestRelayServerPairing(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	relay := NewRelayServer("127.0.0.1:0")
+	assert.Nil(t, relay.Start(ctx))
+	transport := &RelayTransport{Relay: relay.Addr().String(), Code: "code", PeerTimeout: 3 * time.Second}
+
+	waiter, err := transport.Listen("")
+	assert.Nil(t, err)
+	defer func() {
+		_ = waiter.Close()
+	}()
+	sender, err := transport.Dial("")
+	assert.Nil(t, err)
+	defer func() {
+		_ = sender.Close()
+	}()
+
+	// the pair is locked, the others fail without waiting for the peer
+	begin := time.Now()
+	_, err = transport.Dial("")
+	assert.ErrorIs(t, err, ErrPeerNotFound)
+	assert.Less(t, time.Since(begin), transport.PeerTimeout)
+
+	another, err := transport.Listen("")
+	assert.Nil(t, err)
+	defer func() {
+		_ = another.Close()
+	}()
+	_ = another.SetReadDeadline(time.Now().Add(3 * time.Second))
+	_, _, err = another.ReadFrom(make([]byte, 10))
+	assert.ErrorIs(t, err, ErrPeerNotFound)
+
+	// the pair still works
+	_, err = sender.Write([]byte("hello"))
+	assert.Nil(t, err)
+	message := make([]byte, 10)
+	_ = waiter.SetReadDeadline(time.Now().Add(3 * time.Second))
+	n, _, err := waiter.ReadFrom(message)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(message[:n]))
+}
@@ -1,33 +1,51 @@
 package pkg
 
 import (
-	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"os"
-	"regexp"
 	"strconv"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"golang.org/x/net/ipv6"
 )
 
 type UDPSender struct {
-	ip   string
-	port int
+	ip        string
+	port      int
+	parallel  int
+	chunk     int
+	mmap      bool
+	compress  string
+	delta     bool
+	secret    string
+	rate      int64
+	transport Transport
+	// idleTimeout and timeout fail the session if the waiter is gone, or it takes too long
+	idleTimeout time.Duration
+	timeout     time.Duration
+	ctx         context.Context
+	events      emitter
 
 	beginTime time.Time
 	endTime   time.Time
+	summary   Summary
 }
 
 func NewUDPSender(ip string) *UDPSender {
 	return &UDPSender{
-		ip:        ip,
-		port:      3000,
-		beginTime: time.Now(),
+		ip:          ip,
+		port:        3000,
+		parallel:    1,
+		transport:   &UDPTransport{},
+		idleTimeout: DefaultIdleTimeout,
+		ctx:         context.Background(),
+		beginTime:   time.Now(),
 	}
 }
 
@@ -36,15 +54,126 @@ func (s *UDPSender) WithPort(port int) *UDPSender {
 	return s
 }
 
+// WithTransport sets the transport, it's UDP by default
+func (s *UDPSender) WithTransport(transport Transport) *UDPSender {
+	s.transport = transport
+	return s
+}
+
+// WithParallel sets the count of the workers, the worker N sends the data to the port plus N.
+// The waiter should listen to the same count of the ports.
+func (s *UDPSender) WithParallel(parallel int) *UDPSender {
+	if parallel > 0 {
+		s.parallel = parallel
+	}
+	return s
+}
+
+// WithChunk sets the size of the data in each datagram, the default one depends on the OS if it's zero.
+// The small chunk which fits the MTU avoids the IP fragmentation, and it's necessary for GSO.
+func (s *UDPSender) WithChunk(chunk int) *UDPSender {
+	s.chunk = chunk
+	return s
+}
+
+// WithMmap reads the file through a memory mapping, it falls back to the regular reading if it's not supported
+func (s *UDPSender) WithMmap(mmap bool) *UDPSender {
+	s.mmap = mmap
+	return s
+}
+
+// WithCompress compresses each chunk with zstd or lz4, the chunks are sent as is if they are not compressible
+func (s *UDPSender) WithCompress(compress string) *UDPSender {
+	s.compress = compress
+	return s
+}
+
+// WithDelta sends the chunks which are different from the existing file of the waiter only.
+// The blocks are compared at the offsets of the chunks, there is no rolling checksum to find the shifted ones.
+func (s *UDPSender) WithDelta(delta bool) *UDPSender {
+	s.delta = delta
+	return s
+}
+
+// WithSecret signs the session with the shared secret, the waiter should have the same one
+func (s *UDPSender) WithSecret(secret string) *UDPSender {
+	s.secret = secret
+	return s
+}
+
+// WithRate limits the sending rate in bytes per second, the retransmissions are counted as well. Zero means no limit.
+func (s *UDPSender) WithRate(rate int64) *UDPSender {
+	s.rate = rate
+	return s
+}
+
+// WithIdleTimeout fails the session if there is no response from the waiter in the duration, zero means no limit
+func (s *UDPSender) WithIdleTimeout(timeout time.Duration) *UDPSender {
+	s.idleTimeout = timeout
+	return s
+}
+
+// WithTimeout fails the session if it takes longer than the duration, zero means no limit
+func (s *UDPSender) WithTimeout(timeout time.Duration) *UDPSender {
+	s.timeout = timeout
+	return s
+}
+
+// WithContext cancels the session once the context is done, Send returns ErrCancelled then
+func (s *UDPSender) WithContext(ctx context.Context) *UDPSender {
+	s.ctx = ctx
+	return s
+}
+
+// WithEvents sends the events of the session to the channel, it's closed once the session is over
+func (s *UDPSender) WithEvents(events chan Event) *UDPSender {
+	s.events = events
+	return s
+}
+
+// Send sends a local file
 func (s *UDPSender) Send(msg chan string, file string) (err error) {
+	var source *fileSource
+	if source, err = openFileSource(file, s.mmap); err != nil {
+		close(msg)
+		s.events.close()
+		s.summary = newSummary(file, 0, 0, 0, "")
+		return
+	}
+	defer func() {
+		_ = source.Close()
+	}()
+	return s.SendReader(msg, file, source, source.size)
+}
+
+// SendReader sends the data of the reader with a file name, the chunks are read at their offsets,
+// so any of them could be read by the workers and the retransmissions at the same time
+func (s *UDPSender) SendReader(msg chan string, filename string, f io.ReaderAt, size int64) (err error) {
 	defer close(msg)
+	defer s.events.close()
+
+	begin := time.Now()
+	var retransmits atomic.Int64
+	var digest string
+	var reader *chunkReader
+	defer func() {
+		// the waiter has the whole file once it succeeded
+		sent := size
+		if err != nil {
+			sent = 0
+			if reader != nil {
+				sent = reader.bytes(retransmits.Load())
+			}
+		}
+		s.summary = newSummary(filename, sent, time.Since(begin), retransmits.Load(), digest)
+	}()
 
-	var f *os.File
-	if f, err = os.Open(file); err != nil {
+	if limit := chunkLimit(s.transport); s.chunk < 0 || s.chunk > limit {
+		err = fmt.Errorf("invalid chunk size %d, it should not be greater than %d", s.chunk, limit)
 		return
 	}
 
-	builder := NewHeaderBuilder(file)
+	builder := NewReaderHeaderBuilder(filename, size).WithChunk(s.chunk).WithSession(RandomCode(sessionIDLength))
 	if err = builder.Build(); err != nil {
 		return
 	}
@@ -55,42 +184,163 @@ func (s *UDPSender) Send(msg chan string, file string) (err error) {
 	msg <- fmt.Sprintf("sending chunk size %d\n", chunk)
 	msg <- fmt.Sprintf("file length %d\n", fileSize)
 	msg <- fmt.Sprintf("connect to %s\n", s.ip)
+	dog := newWatchdog(s.ctx, "waiter", s.idleTimeout, s.timeout)
 
-	var conn net.Conn
-	if conn, err = net.Dial("udp", fmt.Sprintf("%s:%d", s.ip, s.port)); err != nil {
-		return
+	conns := make([]net.Conn, s.parallel)
+	// lingering means the first connection acknowledges the FINs in the background, it's closed there
+	var lingering atomic.Bool
+	closeAll := func() {
+		for i, c := range conns {
+			if c != nil && (i > 0 || !lingering.Load()) {
+				_ = c.Close()
+			}
+		}
 	}
+	defer closeAll()
 	defer func() {
-		_ = conn.Close()
+		if err != nil && s.ctx.Err() != nil && !errors.Is(err, ErrCancelled) {
+			err = fmt.Errorf("%w, %v", ErrCancelled, err)
+		}
 	}()
+	for i := range conns {
+		if conns[i], err = s.transport.Dial(net.JoinHostPort(s.ip, strconv.Itoa(s.port+i))); err != nil {
+			return
+		}
+	}
+	// the blocking reads and writes return once the connections are closed
+	stop := context.AfterFunc(s.ctx, closeAll)
+	defer stop()
+	conn := conns[0]
 
-	msg <- "start to send data\n"
-	reader := bufio.NewReader(f)
-	for i := 0; i < builder.GetBufferCount(); i++ {
-		buf := make([]byte, builder.GetChunk())
-		var n int
-		if n, err = reader.Read(buf); err == io.EOF {
-			break
-		} else if err != nil {
+	var compress *compressor
+	var features []string
+	if s.compress != "" {
+		if compress, err = newCompressor(s.compress); err != nil {
 			return
 		}
+		features = append(features, FeatureCompression)
+	}
+	// there is nothing to compare with an empty file
+	delta := s.delta && builder.GetBufferCount() > 0
+	if delta {
+		features = append(features, FeatureDelta)
+	}
 
-		err = Retry(30, func() error {
-			// no buffer space available might happen on darwin
-			_, err := conn.Write(builder.CreateHeader(i, buf[:n]))
-			return err
-		})
+	// the data is sent once the waiter set up the file, or it rejects the file, such as there is no enough space
+	if err = handshake(conn, newOffer(builder, s.parallel, s.secret, features...), handshakeTimeout); err != nil {
+		return
+	}
+	dog.touch()
+	msg <- "start to send data\n"
+	s.events.emit(Event{Type: EventStart, File: filename, Size: size, Peer: conn.RemoteAddr().String()})
+
+	// the waiter sends the checksum of the written file at the end, it's verified with this one
+	sum := newSourceChecksum(f, size)
+
+	// the waiter knows the sender is alive while it's planning the copies or waiting for the FIN
+	alive := make(chan struct{})
+	defer close(alive)
+	go keepalive(conn, builder.session, alive)
+
+	reader = newChunkReader(f, builder, compress)
+	progressDone := make(chan struct{})
+	progress := sync.WaitGroup{}
+	progress.Add(1)
+	go func() {
+		defer progress.Done()
+		s.events.reportProgress(filename, size, func() int64 {
+			return reader.bytes(retransmits.Load())
+		}, progressDone)
+	}()
+	defer func() {
+		close(progressDone)
+		progress.Wait()
+	}()
 
-		if i == 0 {
-			// give more time to init file for the first package
-			time.Sleep(time.Second)
+	if delta {
+		var sums []blockSum
+		if sums, err = requestSums(conn, builder, deltaTimeout); err != nil {
+			return
+		}
+		dog.touch()
+		if reader.copies, err = planCopies(f, builder, sums); err != nil {
+			return
 		}
+		msg <- fmt.Sprintf("the waiter has %d of %d chunks already\n", len(reader.copies), builder.GetBufferCount())
 	}
-	msg <- "all the data was sent, try to wait for the missing data\n"
+	pace := &pacer{rate: s.rate}
 
 	mapBuffer := NewSafeMap(0)
 	ck := atomic.Bool{}
 	ck.Store(true)
+	// fin is the result of the waiter, it's nil if the file was written
+	fin := make(chan error, 1)
+	// wake tells the retransmission there are missing chunks, or the session is over
+	wake := make(chan struct{}, 1)
+	wakeup := func() {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+	handle := func(index int, ok bool, err error) {
+		if !ok {
+			return
+		}
+		if index == -1 {
+			select {
+			case fin <- err:
+			default:
+			}
+			ck.Store(false)
+		} else {
+			mapBuffer.Put(index, "")
+		}
+		wakeup()
+	}
+
+	// the waiter reports its load while receiving the data
+	sending := make(chan struct{})
+	controlDone := make(chan struct{})
+	go func() {
+		defer close(controlDone)
+		for {
+			select {
+			case <-sending:
+				return
+			default:
+			}
+
+			_ = conn.SetReadDeadline(time.Now().Add(loadInterval))
+			index, ok, readErr := waitingMissing(conn, pace, builder.session, sum)
+			if readErr == nil {
+				dog.touch()
+			}
+			handle(index, ok, readErr)
+		}
+	}()
+
+	workers := sync.WaitGroup{}
+	for i := range conns {
+		begin, end := chunkRange(0, builder.GetBufferCount(), len(conns), i)
+		workers.Add(1)
+		go func(conn net.Conn) {
+			defer workers.Done()
+			sendChunks(reader, conn, begin, end, pace, dog)
+		}(conns[i])
+	}
+	workers.Wait()
+	close(sending)
+	<-controlDone
+	if err = reader.failure(); err != nil {
+		abortSession(conn, builder.session, err)
+		return
+	}
+	if err = dog.check(); err != nil {
+		return
+	}
+	msg <- "all the data was sent, try to wait for the missing data\n"
+
 	wg := sync.WaitGroup{}
 	wg.Add(1)
 	go func() {
@@ -99,42 +349,59 @@ func (s *UDPSender) Send(msg chan string, file string) (err error) {
 
 		for index := mapBuffer.GetLowestAndRemove(); ck.Load(); index = mapBuffer.GetLowestAndRemove() {
 			if index != nil {
-				_ = send(f, reader, conn, *index, chunk, builder)
+				pace.wait()
+				pace.limit(chunk)
+				if sendErr := sendChunk(reader, conn, *index); errors.Is(sendErr, ErrSendFailed) {
+					handle(-1, true, sendErr)
+				}
+				retransmits.Add(1)
 			} else {
 				msg <- "."
-				time.Sleep(time.Second * 3)
+				<-wake
 			}
 		}
 		msg <- "\n"
 	}()
 
+	// the waiter asks for the missing chunks until it sends the FIN
+	var expired error
 	for ck.Load() {
-		var index int
-		var ok bool
-		if index, ok, err = waitingMissing(conn); ok {
-			if index == -1 {
-				ck.Store(false)
-			} else {
-				//fmt.Println("got missing", index)
-				mapBuffer.Put(index, "")
-			}
-		} else if err != nil {
-			if match, _ := regexp.MatchString(".*connection refused.*", err.Error()); match {
-				time.Sleep(time.Second * 2)
-
-				if conn, err = net.Dial("udp", fmt.Sprintf("%s:%d", s.ip, s.port)); err != nil {
-					fmt.Println(err)
-					return
-				}
-				if err = send(f, reader, conn, 0, chunk, builder); err != nil {
-					return err
-				}
-			}
+		if expired = dog.check(); expired != nil {
+			break
 		}
+		_ = conn.SetReadDeadline(time.Now().Add(loadInterval))
+		index, ok, readErr := waitingMissing(conn, pace, builder.session, sum)
+		if readErr == nil || ok {
+			dog.touch()
+		} else if !errors.Is(readErr, os.ErrDeadlineExceeded) {
+			// avoid the busy loop if the connection is broken
+			time.Sleep(loadInterval)
+		}
+		handle(index, ok, readErr)
 	}
-
+	ck.Store(false)
+	wakeup()
 	wg.Wait()
+
+	select {
+	case err = <-fin:
+		if errors.Is(err, ErrSendFailed) {
+			// it failed to read the data before the FIN
+			abortSession(conn, builder.session, err)
+		} else {
+			lingering.Store(true)
+			acknowledgeFinish(conn, builder.session, err)
+		}
+	default:
+		err = expired
+	}
+	if err != nil {
+		return
+	}
+	// the waiter wrote the file which has the same checksum
+	digest, _ = sum.wait()
 	s.endTime = time.Now()
+	s.events.emit(Event{Type: EventComplete, File: filename, Size: size, Bytes: size, Checksum: digest})
 	msg <- "end"
 	return
 }
@@ -144,63 +411,300 @@ func (s *UDPSender) ConsumedTime() time.Duration {
 	return s.endTime.Sub(s.beginTime)
 }
 
-func send(f *os.File, reader *bufio.Reader, conn net.Conn, index, chunk int, builder *HeaderBuilder) (err error) {
-	if _, err = f.Seek(int64(index*chunk), 0); err != nil {
+// Summary returns the result of the last session
+func (s *UDPSender) Summary() Summary {
+	return s.summary
+}
+
+// chunkRange returns the chunks [from, to) of a worker, each worker sends a continuous range of the chunks
+func chunkRange(begin, end, workers, worker int) (from, to int) {
+	size := (end - begin + workers - 1) / workers
+	if from = begin + worker*size; from > end {
+		from = end
+	}
+	if to = from + size; to > end {
+		to = end
+	}
+	return
+}
+
+// chunkReader reads the chunks into the pooled buffers, and compresses them if it's enabled
+type chunkReader struct {
+	f        io.ReaderAt
+	builder  *HeaderBuilder
+	pool     *sync.Pool
+	compress *compressor
+	// copies are the chunks which the waiter already has, see planCopies
+	copies map[int]int
+	// sent is the count of the chunks which were read for sending
+	sent atomic.Int64
+	// failed is the first error of reading the data, the session fails with it
+	failed atomic.Pointer[error]
+}
+
+// newChunkReader creates a reader, the compressor is optional
+func newChunkReader(f io.ReaderAt, builder *HeaderBuilder, compress *compressor) *chunkReader {
+	chunk := builder.GetChunk()
+	return &chunkReader{
+		f:       f,
+		builder: builder,
+		pool: &sync.Pool{
+			New: func() interface{} {
+				// it's able to hold a header and a chunk
+				buf := make([]byte, headerLength+chunk)
+				return &buf
+			},
+		},
+		compress: compress,
+	}
+}
+
+// read reads a chunk at its offset into a buffer from the pool, the frame is the header and the data.
+// It's safe to be called by multiple workers.
+func (r *chunkReader) read(index int) (buf *[]byte, frame []byte, err error) {
+	defer func() {
+		if err == nil {
+			r.sent.Add(1)
+		}
+	}()
+	buf = r.pool.Get().(*[]byte)
+	if source, ok := r.copies[index]; ok {
+		n := copy(*buf, r.builder.headerWithCodec(index, codecCopy))
+		n += copy((*buf)[n:], strconv.Itoa(source))
+		frame = (*buf)[:n]
 		return
 	}
 
-	buf := make([]byte, chunk)
+	offset := int64(index) * int64(r.builder.GetChunk())
+	if holes, ok := r.f.(holeReader); ok && holes.hole(offset, min(int64(r.builder.GetChunk()), r.builder.GetFileSize()-offset)) {
+		frame = r.holeFrame(*buf, index)
+		return
+	}
+
+	// the last chunk is shorter than the others
+	want := int(min(int64(r.builder.GetChunk()), r.builder.GetFileSize()-offset))
 	var n int
-	if n, err = reader.Read(buf); err != nil {
+	if n, err = r.f.ReadAt((*buf)[headerLength:headerLength+want], offset); n == want {
+		// the reader might return io.EOF with the last chunk
+		err = nil
+	} else if err == nil || err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		// the chunk is never readable, the waiter would ask for it forever
+		err = fmt.Errorf("%w, failed to read the chunk %d, %v", ErrSendFailed, index, err)
+		r.failed.CompareAndSwap(nil, &err)
+		return
+	}
+	if isZero((*buf)[headerLength : headerLength+n]) {
+		// the waiter does not write the zero chunks, the file is sparse
+		frame = r.holeFrame(*buf, index)
+		return
+	}
+
+	var codec byte
+	if r.compress != nil {
+		n, codec = r.compress.compress(index, (*buf)[headerLength:headerLength+n])
+	}
+	copy(*buf, r.builder.headerWithCodec(index, codec))
+	frame = (*buf)[:headerLength+n]
+	return
+}
+
+// bytes returns the count of the bytes which were read for sending, the retransmissions are not counted
+func (r *chunkReader) bytes(retransmits int64) int64 {
+	return min(max(r.sent.Load()-retransmits, 0)*int64(r.builder.GetChunk()), r.builder.GetFileSize())
+}
+
+// failure returns the first error of reading the data
+func (r *chunkReader) failure() (err error) {
+	if failed := r.failed.Load(); failed != nil {
+		err = *failed
+	}
+	return
+}
+
+// holeFrame returns the frame of a zero chunk, the data is a placeholder since the frame could not be empty
+func (r *chunkReader) holeFrame(buf []byte, index int) []byte {
+	n := copy(buf, r.builder.headerWithCodec(index, codecHole))
+	buf[n] = '?'
+	return buf[:n+1]
+}
+
+// release puts the buffer back to the pool
+func (r *chunkReader) release(buf *[]byte) {
+	r.pool.Put(buf)
+}
+
+// sendChunks sends the chunks [from, to), multiple chunks are sent in one syscall if the connection supports it.
+// The waiter asks for the missing chunks later, so the errors of sending are ignored.
+// It stops once the watchdog expires, or it fails to read the data.
+func sendChunks(reader *chunkReader, conn net.Conn, from, to int, pace *pacer, dog *watchdog) {
+	writer, ok := conn.(frameBatchWriter)
+	if !ok {
+		for index := from; index < to && dog.check() == nil && reader.failure() == nil; index++ {
+			pace.wait()
+			pace.limit(reader.builder.GetChunk())
+			_ = sendChunk(reader, conn, index)
+		}
+		return
+	}
+
+	bufs := make([]*[]byte, 0, batchSize)
+	frames := make([][]byte, 0, batchSize)
+	for index := from; index < to && dog.check() == nil && reader.failure() == nil; {
+		pace.wait()
+		for ; index < to && len(frames) < batchSize; index++ {
+			buf, frame, err := reader.read(index)
+			if err != nil {
+				reader.release(buf)
+				continue
+			}
+			bufs, frames = append(bufs, buf), append(frames, frame)
+		}
+		pace.limit(len(frames) * reader.builder.GetChunk())
+
+		sent := 0
+		_ = Retry(30, func() (err error) {
+			var n int
+			n, err = writer.WriteFrames(frames[sent:])
+			sent += n
+			return
+		})
+
+		for _, buf := range bufs {
+			reader.release(buf)
+		}
+		bufs, frames = bufs[:0], frames[:0]
+	}
+}
+
+// sendChunk reads a chunk at its offset, so it's safe to be called by multiple workers
+func sendChunk(reader *chunkReader, conn net.Conn, index int) (err error) {
+	buf, frame, err := reader.read(index)
+	defer reader.release(buf)
+	if err != nil {
 		return
 	}
 
 	err = Retry(30, func() error {
-		_, err := conn.Write(builder.CreateHeader(index, buf[:n]))
+		// no buffer space available might happen on darwin
+		_, err := conn.Write(frame)
 		return err
 	})
 	return
 }
 
 // waitingMissing read data, returns the missing index.
-// Consider it has finished if the index is -1.
-func waitingMissing(conn net.Conn) (index int, ok bool, err error) {
-	// format: miss0000000012, the index is 12
-	message := make([]byte, 14)
+// Consider it has finished if the index is -1, the error is not nil if the waiter failed or the checksum is different.
+// The load reports go to the pacer.
+func waitingMissing(conn net.Conn, pace *pacer, session string, sum *sourceChecksum) (index int, ok bool, err error) {
+	// format: miss + session + 0000000012, the index is 12
+	message := make([]byte, 128)
 
 	var rlen int
-	//if err = conn.SetReadDeadline(time.Now().Add(time.Second * 3)); err != nil {
-	//	return
-	//}
-
-	if rlen, err = conn.Read(message[:]); err == nil && rlen == 14 {
-		index, ok = checkMissing(message)
+	if rlen, err = conn.Read(message[:]); err == nil {
+		if load, isLoad := checkLoad(message[:rlen], session); isLoad {
+			pace.report(load)
+		} else if finished, finErr := checkFinish(message[:rlen], session, sum); finished {
+			index, ok, err = -1, true, finErr
+		} else {
+			index, ok = checkMissing(message[:rlen], session)
+		}
 	}
 	return
 }
 
-func checkMissing(message []byte) (index int, ok bool) {
-	var err error
+// checkLoad parses the load report of the session, format: load + session + 0000000080, the load is 80%
+func checkLoad(message []byte, session string) (load int, ok bool) {
+	return parseControlFrame(message, "load", session)
+}
+
+// busyLoad is the load of the waiter which the sender starts to slow down
+const busyLoad = 50
 
-	if strings.HasPrefix(string(message), "miss") {
-		msg := strings.TrimSpace(strings.TrimPrefix(string(message), "miss"))
-		if index, err = strconv.Atoi(msg); err == nil {
-			ok = true
-		}
-	} else if strings.HasPrefix(string(message), "done") {
-		index = -1
-		ok = true
+// pacer slows down the sending according to the load which is reported by the waiter, and the rate limit
+type pacer struct {
+	load     atomic.Int32
+	reported atomic.Int64
+
+	// rate is the maximum bytes per second, it's not limited if it's zero
+	rate  int64
+	lock  sync.Mutex
+	begin time.Time
+	sent  int64
+}
+
+func (p *pacer) report(load int) {
+	p.load.Store(int32(load))
+	p.reported.Store(time.Now().UnixNano())
+}
+
+// wait sleeps a while if the waiter is busy, the more buffers are in use, the longer it sleeps.
+// The stale report is ignored in case the waiter is gone.
+func (p *pacer) wait() {
+	if time.Since(time.Unix(0, p.reported.Load())) > time.Second {
+		return
 	}
-	return
+	if load := p.load.Load(); load >= busyLoad {
+		time.Sleep(time.Duration(load-busyLoad+1) * 100 * time.Microsecond)
+	}
+}
+
+// limit sleeps until sending the bytes does not exceed the rate, it's shared by the workers
+func (p *pacer) limit(n int) {
+	if p.rate <= 0 {
+		return
+	}
+
+	p.lock.Lock()
+	if p.begin.IsZero() {
+		p.begin = time.Now()
+	}
+	p.sent += int64(n)
+	due := p.begin.Add(time.Duration(float64(p.sent) / float64(p.rate) * float64(time.Second)))
+	p.lock.Unlock()
+	time.Sleep(time.Until(due))
+}
+
+// checkMissing parses the missing request of the session.
+// The frames of other sessions are ignored, they might be delayed from a previous run.
+func checkMissing(message []byte, session string) (index int, ok bool) {
+	return parseControlFrame(message, "miss", session)
 }
 
-// FindWaiters finds the potential package waiters, and notify with a channel
-func FindWaiters(ctx context.Context, waiter chan string) {
+// FindWaiters finds the potential package waiters of the default port and group, and notify with a channel
+func FindWaiters(ctx context.Context, waiter chan Peer) {
+	Discovery{}.FindWaiters(ctx, waiter)
+}
+
+// FindWaiters finds the potential package waiters of the group, and notify with a channel
+func (d Discovery) FindWaiters(ctx context.Context, waiter chan Peer) {
+	found := make(chan Peer, 10)
 	go func() {
 		for {
-			var listener *net.UDPConn
-			var err error
+			select {
+			case <-ctx.Done():
+				return
+			case peer := <-found:
+				if peer.Group != d.Group {
+					continue
+				}
+				select {
+				case waiter <- peer:
+				case <-ctx.Done():
+				}
+			}
+		}
+	}()
+
+	// the broadcast might be filtered in some networks, but the multicast is not
+	_ = BrowseMDNS(ctx, MDNSAddress, found)
 
+	go func() {
+		var listener *net.UDPConn
+		var err error
+		for {
 			select {
 			case <-ctx.Done():
 				if listener != nil {
@@ -208,17 +712,53 @@ func FindWaiters(ctx context.Context, waiter chan string) {
 				}
 				return
 			default:
-				listener, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4zero, Port: 9981})
+				if listener == nil {
+					if listener, err = listenDiscovery(d.port()); err != nil {
+						listener = nil
+						time.Sleep(time.Second)
+						continue
+					}
+				}
+
+				// make sure the context could be checked in time
+				_ = listener.SetReadDeadline(time.Now().Add(time.Second))
+
+				data := make([]byte, 1024)
+				n, remoteAddr, err := listener.ReadFromUDP(data)
 				if err != nil {
 					continue
 				}
 
-				data := make([]byte, 1024)
-				_, remoteAddr, err := listener.ReadFromUDP(data)
-				if err == nil {
-					waiter <- remoteAddr.IP.String()
+				if peer, err := ParsePeer(data[:n], remoteAddr); err == nil {
+					select {
+					case found <- peer:
+					case <-ctx.Done():
+					}
 				}
 			}
 		}
 	}()
 }
+
+// listenDiscovery listens to the IPv4 broadcast and the IPv6 multicast announcements with a dual-stack socket
+func listenDiscovery(port int) (listener *net.UDPConn, err error) {
+	if listener, err = net.ListenUDP("udp", &net.UDPAddr{Port: port}); err != nil {
+		return
+	}
+
+	var ifaces []net.Interface
+	if ifaces, err = net.Interfaces(); err != nil {
+		// still able to receive the IPv4 broadcast
+		err = nil
+		return
+	}
+
+	conn := ipv6.NewPacketConn(listener)
+	group := &net.UDPAddr{IP: DiscoveryGroupIPv6}
+	for i := range ifaces {
+		if ifaces[i].Flags&net.FlagUp != 0 && ifaces[i].Flags&net.FlagMulticast != 0 {
+			_ = conn.JoinGroup(&ifaces[i], group)
+		}
+	}
+	return
+}
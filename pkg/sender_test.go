@@ -1,8 +1,14 @@
 package pkg
 
 import (
-	"github.com/stretchr/testify/assert"
+	"net"
+	"os"
+	"path"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestCheckMissing(t *testing.T) {
@@ -13,30 +19,171 @@ func TestCheckMissing(t *testing.T) {
 		wantOK    bool
 	}{{
 		name:      "missing",
-		message:   []byte("miss000123"),
+		message:   []byte("misssession1000123"),
 		wantIndex: 123,
 		wantOK:    true,
 	}, {
 		name:      "missing",
-		message:   []byte("miss   123"),
+		message:   controlFrame("miss", "session1", 123),
 		wantIndex: 123,
 		wantOK:    true,
 	}, {
 		name:      "missing with invalid number",
-		message:   []byte("miss000aaa"),
+		message:   []byte("misssession1000aaa"),
 		wantIndex: 0,
 		wantOK:    false,
 	}, {
-		name:      "done",
-		message:   []byte("done0000"),
-		wantIndex: -1,
-		wantOK:    true,
+		name:    "missing of another session",
+		message: controlFrame("miss", "session0", 123),
+		wantOK:  false,
+	}, {
+		name:    "FIN is not a missing request",
+		message: controlFrame(finPrefix, "session1", 0),
+		wantOK:  false,
 	}}
 	for i, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			index, ok := checkMissing(tt.message)
+			index, ok := checkMissing(tt.message, "session1")
 			assert.Equal(t, tt.wantIndex, index, "failed in case [%d]", i)
 			assert.Equal(t, tt.wantOK, ok, "failed in case [%d]", i)
 		})
 	}
 }
+
+func TestChunkRange(t *testing.T) {
+	tests := []struct {
+		name       string
+		begin, end int
+		workers    int
+		wantRanges [][2]int
+	}{{
+		name:       "one worker",
+		begin:      1,
+		end:        10,
+		workers:    1,
+		wantRanges: [][2]int{{1, 10}},
+	}, {
+		name:       "even",
+		begin:      0,
+		end:        9,
+		workers:    3,
+		wantRanges: [][2]int{{0, 3}, {3, 6}, {6, 9}},
+	}, {
+		name:       "uneven",
+		begin:      1,
+		end:        11,
+		workers:    3,
+		wantRanges: [][2]int{{1, 5}, {5, 9}, {9, 11}},
+	}, {
+		name:       "more workers than chunks",
+		begin:      1,
+		end:        3,
+		workers:    4,
+		wantRanges: [][2]int{{1, 2}, {2, 3}, {3, 3}, {3, 3}},
+	}}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for worker, want := range tt.wantRanges {
+				from, to := chunkRange(tt.begin, tt.end, tt.workers, worker)
+				assert.Equal(t, want, [2]int{from, to}, "failed in case [%d], worker %d", i, worker)
+			}
+		})
+	}
+}
+
+func TestSendChunk(t *testing.T) {
+	file := path.Join(os.TempDir(), "fake-chunks")
+	data := strings.Repeat("a", 60000) + "hello"
+	assert.Nil(t, os.WriteFile(file, []byte(data), 0600))
+	defer func() {
+		_ = os.RemoveAll(file)
+	}()
+
+	builder := NewHeaderBuilder(file)
+	assert.Nil(t, builder.Build())
+	if builder.GetChunk() != 60000 {
+		t.Skip("the chunk size is different on this platform")
+	}
+
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer func() {
+		_ = server.Close()
+	}()
+	conn, err := net.Dial("udp", server.LocalAddr().String())
+	assert.Nil(t, err)
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	f, err := os.Open(file)
+	assert.Nil(t, err)
+	defer func() {
+		_ = f.Close()
+	}()
+
+	// the chunks could be sent in any order
+	reader := newChunkReader(f, builder, nil)
+	message := make([]byte, 65507)
+	for _, index := range []int{1, 0, 1} {
+		assert.Nil(t, sendChunk(reader, conn, index))
+
+		n, _, err := server.ReadFrom(message)
+		assert.Nil(t, err)
+		header, err := readHeaderFromData(ReceivedData{Data: message[:n]})
+		assert.Nil(t, err)
+		assert.Equal(t, index, header.index)
+		assert.Equal(t, data[index*60000:min(len(data), (index+1)*60000)], string(header.data))
+	}
+}
+
+func TestCheckLoad(t *testing.T) {
+	load, ok := checkLoad([]byte("loadsession1        80"), "session1")
+	assert.True(t, ok)
+	assert.Equal(t, 80, load)
+
+	_, ok = checkLoad([]byte("loadsession1       abc"), "session1")
+	assert.False(t, ok)
+	_, ok = checkLoad([]byte("misssession1        80"), "session1")
+	assert.False(t, ok)
+	_, ok = checkLoad(controlFrame("load", "session0", 80), "session1")
+	assert.False(t, ok)
+}
+
+func TestPacer(t *testing.T) {
+	pace := &pacer{}
+	pace.report(100)
+	begin := time.Now()
+	pace.wait()
+	assert.GreaterOrEqual(t, time.Since(begin), 5*time.Millisecond)
+
+	// not busy
+	pace.report(10)
+	begin = time.Now()
+	pace.wait()
+	assert.Less(t, time.Since(begin), 5*time.Millisecond)
+
+	// the stale report is ignored
+	pace.report(100)
+	pace.reported.Store(time.Now().Add(-2 * time.Second).UnixNano())
+	begin = time.Now()
+	pace.wait()
+	assert.Less(t, time.Since(begin), 5*time.Millisecond)
+}
+
+func TestPacerLimit(t *testing.T) {
+	// not limited
+	pace := &pacer{}
+	begin := time.Now()
+	pace.limit(1 << 30)
+	assert.Less(t, time.Since(begin), 5*time.Millisecond)
+
+	// 10 KB per second, each chunk of 1 KB waits for 100ms including the first one
+	pace = &pacer{rate: 10000}
+	begin = time.Now()
+	for i := 0; i < 3; i++ {
+		pace.limit(1000)
+	}
+	assert.GreaterOrEqual(t, time.Since(begin), 300*time.Millisecond)
+	assert.Less(t, time.Since(begin), 600*time.Millisecond)
+}
@@ -0,0 +1,153 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+// Server receives the data from the clients, or from the senders of the transfer command.
+// It serves one session at a time, the ports are listened to from Accept until the session is over.
+type Server struct {
+	listen  string
+	port    int
+	options options
+}
+
+// NewServer creates a server which listens to the address, such as: :3000
+func NewServer(address string, opts ...Option) (server *Server, err error) {
+	var listen string
+	var port int
+	if listen, port, err = splitAddress(address); err == nil {
+		server = &Server{listen: listen, port: port, options: newOptions(opts)}
+	}
+	return
+}
+
+// Accept waits for an offer, the offers which fail to verify or exceed the quota are rejected.
+// The context cancels the waiting and the session of the returned one.
+func (s *Server) Accept(ctx context.Context) (in *Incoming, err error) {
+	if in, err = s.options.waiter(s.listen, s.port).WithContext(ctx).accept(nil); err != nil {
+		return
+	}
+	if err = checkQuota(in.Size, s.options.quota); err != nil {
+		_ = in.Reject(err)
+		in = nil
+	}
+	return
+}
+
+// Incoming is an offer from a client, either SaveTo or Reject should be called to finish it
+type Incoming struct {
+	Metadata Metadata
+	// Size is the count of the bytes to receive
+	Size int64
+	// Peer is the address of the client
+	Peer net.Addr
+
+	waiter *UDPWaiter
+	conn   net.PacketConn
+	// extra receives the data of the ports after the first one, it's nil if there's only one port
+	extra  net.PacketConn
+	stop   func() bool
+	offer  offer
+	header dataHeader
+	closed bool
+	// written is the count of the bytes which were written, it's set once the session is over
+	written int64
+}
+
+// SaveTo accepts the offer and writes the data at their offsets, the chunks arrive in any order.
+// The checksum is verified by both sides if the writer is an io.ReaderAt as well, such as a file.
+func (in *Incoming) SaveTo(writer io.WriterAt) (summary Summary, err error) {
+	if in.closed {
+		err = errors.New("the session is over")
+		summary.Error = err.Error()
+		return
+	}
+
+	var sum string
+	var requests int64
+	begin := time.Now()
+	defer func() {
+		if err = in.close(err); err != nil {
+			sum = ""
+		}
+		summary = newSummary(in.Metadata.Name, in.written, time.Since(begin), requests, sum)
+		if err != nil {
+			summary.Error = err.Error()
+		}
+	}()
+
+	// there is no original file to copy the chunks from
+	sum, requests, err = in.receive(in.Metadata.Name, &chunkWriter{f: writer}, "")
+	return
+}
+
+// SaveFile accepts the offer and writes the data into the file. If the file exists and the client sends the delta,
+// the unchanged blocks are copied from it, the file is replaced once the data is verified.
+func (in *Incoming) SaveFile(path string) (summary Summary, err error) {
+	if in.closed {
+		err = errors.New("the session is over")
+		summary.Error = err.Error()
+		return
+	}
+
+	var sum string
+	var requests int64
+	begin := time.Now()
+	defer func() {
+		if err = in.close(err); err != nil {
+			sum = ""
+		}
+		summary = newSummary(path, in.written, time.Since(begin), requests, sum)
+		if err != nil {
+			summary.Error = err.Error()
+		}
+	}()
+
+	var f *os.File
+	var output string
+	if f, output, err = in.create(path); err != nil {
+		return
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	sum, requests, err = in.receiveFile(f, output, path)
+	return
+}
+
+// Reject tells the client the reason of rejecting the offer, such as ErrInsufficientSpace
+func (in *Incoming) Reject(reason error) (err error) {
+	if in.closed {
+		return errors.New("the session is over")
+	}
+	err = in.reject(reason)
+	_ = in.close(nil)
+	return
+}
+
+// reject replies the reason to the sender, the ports are still listened to
+func (in *Incoming) reject(reason error) error {
+	return replyReject(in.conn, in.Peer, in.offer.Session, reason)
+}
+
+// close stops listening to the ports, the error is marked as ErrCancelled if the context was done
+func (in *Incoming) close(err error) error {
+	in.closed = true
+	in.stop()
+	_ = in.conn.Close()
+	if in.extra != nil {
+		_ = in.extra.Close()
+	}
+
+	if ctx := in.waiter.ctx; err != nil && ctx.Err() != nil && !errors.Is(err, ErrCancelled) {
+		err = fmt.Errorf("%w, %v", ErrCancelled, err)
+	}
+	return err
+}
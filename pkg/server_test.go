@@ -0,0 +1,200 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryFile is an in-memory io.WriterAt, it grows once the data is written out of it
+type memoryFile struct {
+	lock sync.Mutex
+	data []byte
+}
+
+func (m *memoryFile) WriteAt(p []byte, off int64) (n int, err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if end := int(off) + len(p); end > len(m.data) {
+		m.data = append(m.data, make([]byte, end-len(m.data))...)
+	}
+	n = copy(m.data[off:], p)
+	return
+}
+
+// readableMemoryFile could be read for the checksum
+type readableMemoryFile struct {
+	memoryFile
+}
+
+func (m *readableMemoryFile) ReadAt(p []byte, off int64) (n int, err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return bytes.NewReader(m.data).ReadAt(p, off)
+}
+
+func TestClientServer(t *testing.T) {
+	data := append(bytes.Repeat([]byte("hello transfer "), 1000), make([]byte, 3000)...)
+	untrusted, err := ParseTrustedPeers([]string{"10.0.0.0/8"})
+	assert.Nil(t, err)
+	// the last block of the data is a partial one
+	delta := []Option{WithDelta(true), WithChunk(1024)}
+	changed := func(data []byte, offsets ...int) []byte {
+		data = append([]byte(nil), data...)
+		for _, offset := range offsets {
+			data[offset]++
+		}
+		return data
+	}
+
+	tests := []struct {
+		name          string
+		clientOptions []Option
+		serverOptions []Option
+		writer        io.WriterAt
+		// existing is the file of the server, the data is saved into it if it's not nil
+		existing []byte
+		// size is the size which the client declares, it's the size of the data if it's zero
+		size          int64
+		wantChecksum  bool
+		wantErr       error
+		wantServerErr string
+	}{{
+		name:         "readable writer",
+		writer:       &readableMemoryFile{},
+		wantChecksum: true,
+	}, {
+		name:          "write only",
+		clientOptions: []Option{WithCompress("zstd")},
+		writer:        &memoryFile{},
+	}, {
+		name:          "delta with a shorter existing file",
+		clientOptions: delta,
+		existing:      changed(data[:5000], 100),
+		wantChecksum:  true,
+	}, {
+		name:          "delta with a longer existing file",
+		clientOptions: delta,
+		existing:      changed(append(data, bytes.Repeat([]byte("more"), 1000)...), 3000),
+		wantChecksum:  true,
+	}, {
+		name:          "delta with a changed final partial block",
+		clientOptions: delta,
+		existing:      changed(data, len(data)-1),
+		wantChecksum:  true,
+	}, {
+		name:          "delta without an existing file",
+		clientOptions: delta,
+		existing:      []byte{},
+		wantChecksum:  true,
+	}, {
+		name:          "reader is shorter than the size",
+		writer:        &memoryFile{},
+		size:          int64(len(data)) * 2,
+		wantErr:       ErrSendFailed,
+		wantServerErr: "failed to read the chunk",
+	}, {
+		name:          "exceeds the quota",
+		serverOptions: []Option{WithQuota(1024)},
+		wantErr:       ErrInsufficientSpace,
+	}, {
+		name:          "untrusted peer",
+		serverOptions: []Option{WithTrustedPeers(untrusted)},
+		wantErr:       ErrRejected,
+	}, {
+		name:          "different secret",
+		clientOptions: []Option{WithSecret("one")},
+		serverOptions: []Option{WithSecret("another")},
+		wantErr:       ErrAuthFailed,
+	}}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port, err := freePort()
+			assert.Nil(t, err, "failed in case [%d]", i)
+			address := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+			server, err := NewServer(address, tt.serverOptions...)
+			assert.Nil(t, err, "failed in case [%d]", i)
+			client, err := NewClient(address, tt.clientOptions...)
+			assert.Nil(t, err, "failed in case [%d]", i)
+
+			size := tt.size
+			if size == 0 {
+				size = int64(len(data))
+			}
+			path := filepath.Join(t.TempDir(), "hello.txt")
+			if len(tt.existing) > 0 {
+				assert.Nil(t, os.WriteFile(path, tt.existing, 0640), "failed in case [%d]", i)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			received := make(chan Summary, 1)
+			go func() {
+				defer close(received)
+				in, acceptErr := server.Accept(ctx)
+				if acceptErr != nil {
+					return
+				}
+				assert.Equal(t, "hello.txt", in.Metadata.Name, "failed in case [%d]", i)
+				assert.Equal(t, size, in.Size, "failed in case [%d]", i)
+				var summary Summary
+				if tt.existing != nil {
+					summary, _ = in.SaveFile(path)
+				} else {
+					summary, _ = in.SaveTo(tt.writer)
+				}
+				received <- summary
+			}()
+
+			// the server might not be listening yet
+			time.Sleep(100 * time.Millisecond)
+			summary, err := client.Send(ctx, bytes.NewReader(data), size, Metadata{Name: "dir/hello.txt"})
+			serverSummary := <-received
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr, "failed in case [%d]", i)
+				assert.NotEmpty(t, summary.Error, "failed in case [%d]", i)
+				assert.Contains(t, serverSummary.Error, tt.wantServerErr, "failed in case [%d]", i)
+				// the bytes which were sent or written only
+				assert.Less(t, summary.Bytes, size, "failed in case [%d]", i)
+				assert.Less(t, serverSummary.Bytes, size, "failed in case [%d]", i)
+				return
+			}
+
+			assert.Nil(t, err, "failed in case [%d]", i)
+			assert.Empty(t, serverSummary.Error, "failed in case [%d]", i)
+			assert.Equal(t, int64(len(data)), serverSummary.Bytes, "failed in case [%d]", i)
+			assert.Equal(t, tt.wantChecksum, serverSummary.Checksum != "", "failed in case [%d]", i)
+			switch writer := tt.writer.(type) {
+			case *memoryFile:
+				assert.Equal(t, data, writer.data, "failed in case [%d]", i)
+			case *readableMemoryFile:
+				assert.Equal(t, data, writer.data, "failed in case [%d]", i)
+			default:
+				saved, readErr := os.ReadFile(path)
+				assert.Nil(t, readErr, "failed in case [%d]", i)
+				assert.Equal(t, data, saved, "failed in case [%d]", i)
+			}
+		})
+	}
+}
+
+func TestServerAcceptCancelled(t *testing.T) {
+	port, err := freePort()
+	assert.Nil(t, err)
+	server, err := NewServer(net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	_, err = server.Accept(ctx)
+	assert.ErrorIs(t, err, ErrCancelled)
+}
@@ -0,0 +1,63 @@
+package pkg
+
+import (
+	"io"
+	"os"
+)
+
+// fileSource is the content of a file which could be read at any offset
+type fileSource struct {
+	io.ReaderAt
+	size  int64
+	close func() error
+	// holes are the holes of a sparse file in order
+	holes []span
+}
+
+// openFileSource opens a file, it's mapped into the memory if mmap is true and supported
+func openFileSource(file string, mmap bool) (source *fileSource, err error) {
+	var f *os.File
+	if f, err = os.Open(file); err != nil {
+		return
+	}
+
+	var fi os.FileInfo
+	if fi, err = f.Stat(); err != nil {
+		_ = f.Close()
+		return
+	}
+
+	source = &fileSource{ReaderAt: f, size: fi.Size(), close: f.Close, holes: findHoles(f, fi.Size())}
+	if mmap && fi.Size() > 0 {
+		if data, mmapErr := mmapFile(f, fi.Size()); mmapErr == nil {
+			// the mapping keeps working after the file was closed
+			_ = f.Close()
+			source.ReaderAt, source.close = &mmapReader{data: data}, func() error {
+				return munmap(data)
+			}
+		}
+	}
+	return
+}
+
+// Close releases the file or the memory mapping
+func (s *fileSource) Close() error {
+	return s.close()
+}
+
+// mmapReader reads the data from a memory mapping
+type mmapReader struct {
+	data []byte
+}
+
+// ReadAt copies the data at the offset
+func (r *mmapReader) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 || off >= int64(len(r.data)) {
+		err = io.EOF
+		return
+	}
+	if n = copy(p, r.data[off:]); n < len(p) {
+		err = io.EOF
+	}
+	return
+}
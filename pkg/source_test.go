@@ -0,0 +1,69 @@
+package pkg
+
+import (
+	"io"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenFileSource(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		mmap    bool
+	}{{
+		name:    "regular file",
+		content: "hello world",
+	}, {
+		name:    "memory mapping",
+		content: "hello world",
+		mmap:    true,
+	}, {
+		name: "empty file with memory mapping",
+		mmap: true,
+	}}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := path.Join(t.TempDir(), "source")
+			assert.Nil(t, os.WriteFile(file, []byte(tt.content), 0600), "failed in case [%d]", i)
+
+			source, err := openFileSource(file, tt.mmap)
+			if !assert.Nil(t, err, "failed in case [%d]", i) {
+				return
+			}
+			defer func() {
+				assert.Nil(t, source.Close(), "failed in case [%d]", i)
+			}()
+			assert.Equal(t, int64(len(tt.content)), source.size, "failed in case [%d]", i)
+
+			// read the chunks in any order
+			buf := make([]byte, 5)
+			for _, offset := range []int64{6, 0} {
+				if offset >= source.size {
+					continue
+				}
+				n, err := source.ReadAt(buf, offset)
+				assert.Nil(t, err, "failed in case [%d]", i)
+				assert.Equal(t, tt.content[offset:offset+5], string(buf[:n]), "failed in case [%d]", i)
+			}
+
+			// the last chunk is shorter
+			n, err := source.ReadAt(buf, 8)
+			if len(tt.content) > 8 {
+				assert.Equal(t, io.EOF, err, "failed in case [%d]", i)
+				assert.Equal(t, "rld", string(buf[:n]), "failed in case [%d]", i)
+			} else {
+				assert.Equal(t, io.EOF, err, "failed in case [%d]", i)
+				assert.Equal(t, 0, n, "failed in case [%d]", i)
+			}
+		})
+	}
+}
+
+func TestOpenFileSourceNotExist(t *testing.T) {
+	_, err := openFileSource(path.Join(t.TempDir(), "fake"), true)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,76 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ErrInsufficientSpace means the waiter could not hold the file
+var ErrInsufficientSpace = errors.New("receiver has insufficient space")
+
+// checkSpace makes sure the file fits the quota and the free space of the directory,
+// the existing file will be replaced so its space is counted as free. The quota is not limited if it's zero.
+func checkSpace(dir, existing string, required, quota int64) (err error) {
+	if err = checkQuota(required, quota); err != nil {
+		return
+	}
+
+	if dir == "" {
+		dir = "."
+	}
+	available, spaceErr := FreeSpace(dir)
+	if spaceErr != nil {
+		// not supported on this platform, it fails once writing the file
+		return
+	}
+	free := int64(available)
+	if fi, statErr := os.Stat(existing); statErr == nil && fi.Mode().IsRegular() {
+		free += fi.Size()
+	}
+	if required > free {
+		err = fmt.Errorf("%w, %s is required but %s is available", ErrInsufficientSpace, formatSize(required), formatSize(free))
+	}
+	return
+}
+
+// checkQuota makes sure the file fits the quota, it's not limited if the quota is zero
+func checkQuota(required, quota int64) (err error) {
+	if quota > 0 && required > quota {
+		err = fmt.Errorf("%w, the file size %s exceeds the quota %s", ErrInsufficientSpace, formatSize(required), formatSize(quota))
+	}
+	return
+}
+
+// ParseSize parses a size with an optional unit, such as: 1024, 512K, 10M, 1.5G, 2T
+func ParseSize(size string) (result int64, err error) {
+	text := strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(size)), "B"), "I")
+	unit := int64(1)
+	if i := strings.IndexAny(text, "KMGT"); i >= 0 && i == len(text)-1 {
+		unit = 1 << (10 * (strings.IndexByte("KMGT", text[i]) + 1))
+		text = text[:i]
+	}
+
+	var value float64
+	if value, err = strconv.ParseFloat(strings.TrimSpace(text), 64); err != nil || value < 0 {
+		err = fmt.Errorf("invalid size: '%s'", size)
+		return
+	}
+	result = int64(value * float64(unit))
+	return
+}
+
+// formatSize returns a readable size, such as: 1.5 GB
+func formatSize(size int64) string {
+	const units = "KMGT"
+	value, unit := float64(size), -1
+	for value >= 1024 && unit < len(units)-1 {
+		value, unit = value/1024, unit+1
+	}
+	if unit < 0 {
+		return fmt.Sprintf("%d B", size)
+	}
+	return fmt.Sprintf("%.1f %cB", value, units[unit])
+}
@@ -0,0 +1,101 @@
+package pkg
+
+import (
+	"errors"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		size    string
+		want    int64
+		wantErr bool
+	}{{
+		size: "1024",
+		want: 1024,
+	}, {
+		size: "512K",
+		want: 512 << 10,
+	}, {
+		size: "10MB",
+		want: 10 << 20,
+	}, {
+		size: "1.5G",
+		want: 3 << 29,
+	}, {
+		size: "2 TiB",
+		want: 2 << 40,
+	}, {
+		size:    "",
+		wantErr: true,
+	}, {
+		size:    "10X",
+		wantErr: true,
+	}, {
+		size:    "-1G",
+		wantErr: true,
+	}}
+	for i, tt := range tests {
+		t.Run(tt.size, func(t *testing.T) {
+			result, err := ParseSize(tt.size)
+			assert.Equal(t, tt.wantErr, err != nil, "failed in case [%d]", i)
+			assert.Equal(t, tt.want, result, "failed in case [%d]", i)
+		})
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	assert.Equal(t, "100 B", formatSize(100))
+	assert.Equal(t, "1.5 KB", formatSize(1536))
+	assert.Equal(t, "10.0 GB", formatSize(10<<30))
+}
+
+func TestCheckSpace(t *testing.T) {
+	dir := t.TempDir()
+	existing := path.Join(dir, "existing")
+	assert.Nil(t, os.WriteFile(existing, []byte("hello"), 0600))
+
+	tests := []struct {
+		name     string
+		existing string
+		required int64
+		quota    int64
+		wantErr  bool
+	}{{
+		name:     "small file",
+		required: 1024,
+	}, {
+		name:     "within the quota",
+		required: 1024,
+		quota:    1024,
+	}, {
+		name:     "exceeds the quota",
+		required: 1025,
+		quota:    1024,
+		wantErr:  true,
+	}, {
+		name:     "replace the existing file",
+		existing: existing,
+		required: 1024,
+	}, {
+		name:     "larger than the file system",
+		required: 1 << 62,
+		wantErr:  true,
+	}}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := FreeSpace(dir); err != nil && tt.quota == 0 && tt.wantErr {
+				t.Skip("the free space is unknown on this platform")
+			}
+			err := checkSpace(dir, tt.existing, tt.required, tt.quota)
+			assert.Equal(t, tt.wantErr, err != nil, "failed in case [%d]", i)
+			if err != nil {
+				assert.True(t, errors.Is(err, ErrInsufficientSpace), "failed in case [%d]", i)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package pkg
+
+import (
+	"bytes"
+	"os"
+	"sort"
+)
+
+// codecHole tells the waiter the chunk is all zeros, the data of the frame is ignored
+const codecHole byte = 'h'
+
+// zeroChunk is compared with the chunks to find the zero ones
+var zeroChunk = make([]byte, maxChunk)
+
+// span is a range of a file, the end is excluded
+type span struct {
+	start, end int64
+}
+
+// isZero returns true if all the bytes are zero
+func isZero(data []byte) bool {
+	for len(data) > 0 {
+		n := min(len(data), len(zeroChunk))
+		if !bytes.Equal(data[:n], zeroChunk[:n]) {
+			return false
+		}
+		data = data[n:]
+	}
+	return true
+}
+
+// holeReader is implemented by the sources which know the holes of a sparse file
+type holeReader interface {
+	// hole returns true if the whole range is in a hole
+	hole(offset, length int64) bool
+}
+
+// hole returns true if the whole range is in one of the holes of the file
+func (s *fileSource) hole(offset, length int64) bool {
+	i := sort.Search(len(s.holes), func(i int) bool {
+		return s.holes[i].end > offset
+	})
+	return i < len(s.holes) && s.holes[i].start <= offset && s.holes[i].end >= offset+length
+}
+
+// allocateFile sets the size of the file, it keeps sparse until the data is written.
+// The disk space is allocated as well if preallocate is true.
+func allocateFile(f *os.File, size int64, preallocate bool) (err error) {
+	if err = f.Truncate(size); err != nil || !preallocate || size == 0 {
+		return
+	}
+	if err = fallocate(f, size); err == nil {
+		return
+	}
+
+	// write the zeros if the file system does not support it
+	for offset := int64(0); offset < size; offset += int64(len(zeroChunk)) {
+		if _, err = f.WriteAt(zeroChunk[:min(int64(len(zeroChunk)), size-offset)], offset); err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,44 @@
+//go:build linux
+
+package pkg
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// the whence values of lseek to find the data and the holes of a sparse file
+const (
+	seekData = 3
+	seekHole = 4
+)
+
+// findHoles returns the holes of a sparse file, it's empty if the file system does not support it
+func findHoles(f *os.File, size int64) (holes []span) {
+	for offset := int64(0); offset < size; {
+		data, err := f.Seek(offset, seekData)
+		if errors.Is(err, syscall.ENXIO) {
+			// there is no data after the offset
+			data = size
+		} else if err != nil {
+			return nil
+		}
+		if data > offset {
+			holes = append(holes, span{start: offset, end: data})
+		}
+		if data >= size {
+			break
+		}
+
+		if offset, err = f.Seek(data, seekHole); err != nil {
+			return nil
+		}
+	}
+	return
+}
+
+// fallocate allocates the disk space of the file
+func fallocate(f *os.File, size int64) error {
+	return syscall.Fallocate(int(f.Fd()), 0, 0, size)
+}
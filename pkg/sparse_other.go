@@ -0,0 +1,18 @@
+//go:build !linux
+
+package pkg
+
+import (
+	"errors"
+	"os"
+)
+
+// findHoles is not supported, all the chunks are read
+func findHoles(f *os.File, size int64) (holes []span) {
+	return
+}
+
+// fallocate is not supported, the zeros are written instead
+func fallocate(f *os.File, size int64) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,137 @@
+package pkg
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsZero(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{{
+		name: "empty",
+		want: true,
+	}, {
+		name: "zeros",
+		data: make([]byte, 1000),
+		want: true,
+	}, {
+		name: "larger than a chunk",
+		data: make([]byte, maxChunk*2+1),
+		want: true,
+	}, {
+		name: "not zero at the end",
+		data: append(make([]byte, maxChunk+1), 1),
+	}, {
+		name: "text",
+		data: []byte("hello"),
+	}}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isZero(tt.data), "failed in case [%d]", i)
+		})
+	}
+}
+
+func TestFileSourceHole(t *testing.T) {
+	source := &fileSource{holes: []span{{start: 0, end: 100}, {start: 200, end: 300}}}
+	tests := []struct {
+		name   string
+		offset int64
+		length int64
+		want   bool
+	}{{
+		name:   "the first hole",
+		offset: 0,
+		length: 100,
+		want:   true,
+	}, {
+		name:   "inside the second hole",
+		offset: 220,
+		length: 50,
+		want:   true,
+	}, {
+		name:   "across the data",
+		offset: 50,
+		length: 100,
+	}, {
+		name:   "in the data",
+		offset: 100,
+		length: 10,
+	}, {
+		name:   "after the holes",
+		offset: 300,
+		length: 10,
+	}}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, source.hole(tt.offset, tt.length), "failed in case [%d]", i)
+		})
+	}
+}
+
+func TestFindHoles(t *testing.T) {
+	file := path.Join(t.TempDir(), "sparse")
+	f, err := os.Create(file)
+	assert.Nil(t, err)
+	defer func() {
+		_ = f.Close()
+	}()
+
+	const size = 4 << 20
+	data := bytes.Repeat([]byte("a"), 4096)
+	assert.Nil(t, f.Truncate(size))
+	_, err = f.WriteAt(data, 1<<20)
+	assert.Nil(t, err)
+
+	// the holes are optional, but the data should never be in them
+	for _, hole := range findHoles(f, size) {
+		assert.True(t, hole.end <= 1<<20 || hole.start >= 1<<20+4096, "the data is in the hole %v", hole)
+	}
+}
+
+func TestAllocateFile(t *testing.T) {
+	for i, preallocate := range []bool{false, true} {
+		f, err := os.Create(path.Join(t.TempDir(), "file"))
+		assert.Nil(t, err, "failed in case [%d]", i)
+
+		// the written data is kept
+		_, err = f.Write([]byte("hello"))
+		assert.Nil(t, err, "failed in case [%d]", i)
+		assert.Nil(t, allocateFile(f, 1000, preallocate), "failed in case [%d]", i)
+		_ = f.Close()
+
+		data, err := os.ReadFile(f.Name())
+		assert.Nil(t, err, "failed in case [%d]", i)
+		assert.Equal(t, 1000, len(data), "failed in case [%d]", i)
+		assert.Equal(t, "hello", string(data[:5]), "failed in case [%d]", i)
+		assert.True(t, isZero(data[5:]), "failed in case [%d]", i)
+	}
+}
+
+func TestChunkReaderHole(t *testing.T) {
+	data := append(make([]byte, 20), []byte("hello")...)
+	source := &fileSource{ReaderAt: bytes.NewReader(data), size: int64(len(data)), holes: []span{{start: 0, end: 10}}}
+	builder := NewReaderHeaderBuilder("fake", source.size).WithChunk(10)
+	assert.Nil(t, builder.Build())
+
+	reader := newChunkReader(source, builder, nil)
+	for index, wantCodec := range []byte{codecHole, codecHole, 0} {
+		buf, frame, err := reader.read(index)
+		assert.Nil(t, err, "failed in case [%d]", index)
+
+		header, err := readHeaderFromData(ReceivedData{Data: frame})
+		assert.Nil(t, err, "failed in case [%d]", index)
+		assert.Equal(t, wantCodec, header.codec, "failed in case [%d]", index)
+		if wantCodec == 0 {
+			assert.Equal(t, "hello", string(header.data), "failed in case [%d]", index)
+		}
+		reader.release(buf)
+	}
+}
@@ -0,0 +1,86 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultIdleTimeout is the duration of a session without any frame from the peer before it fails
+	DefaultIdleTimeout = 30 * time.Second
+	// keepalivePrefix keeps the session alive when there is no data, format: ping + session + 0000000000
+	keepalivePrefix = "ping"
+	// keepaliveInterval is the interval of sending the keepalive, it should be far less than the idle timeout
+	keepaliveInterval = 2 * time.Second
+	// pollInterval is the interval of checking the timeouts while waiting for a frame
+	pollInterval = time.Second
+)
+
+// ErrTimeout means the peer was gone, or the session took too long
+var ErrTimeout = errors.New("timeout")
+
+// watchdog fails a session which is idle for too long, lasts longer than the timeout, or the context is done.
+// A zero duration means no limit, and a nil watchdog never expires.
+type watchdog struct {
+	ctx     context.Context
+	peer    string
+	idle    time.Duration
+	timeout time.Duration
+	begin   time.Time
+	active  atomic.Int64
+}
+
+// newWatchdog creates a watchdog of the peer, the peer is the name in the error message
+func newWatchdog(ctx context.Context, peer string, idle, timeout time.Duration) *watchdog {
+	dog := &watchdog{
+		ctx:     ctx,
+		peer:    peer,
+		idle:    idle,
+		timeout: timeout,
+		begin:   time.Now(),
+	}
+	dog.touch()
+	return dog
+}
+
+// touch records a frame from the peer, it's safe to be called by multiple goroutines
+func (d *watchdog) touch() {
+	if d != nil {
+		d.active.Store(time.Now().UnixNano())
+	}
+}
+
+// check returns an error which wraps ErrTimeout if the session is expired, or ErrCancelled if the context is done
+func (d *watchdog) check() (err error) {
+	if d == nil {
+		return
+	}
+
+	if ctxErr := d.ctx.Err(); ctxErr != nil {
+		err = fmt.Errorf("%w, %v", ErrCancelled, ctxErr)
+	} else if idle := time.Since(time.Unix(0, d.active.Load())); d.idle > 0 && idle > d.idle {
+		err = fmt.Errorf("%w: no response from the %s in %v, it might be gone or the network is down",
+			ErrTimeout, d.peer, d.idle)
+	} else if d.timeout > 0 && time.Since(d.begin) > d.timeout {
+		err = fmt.Errorf("%w: the session took longer than %v", ErrTimeout, d.timeout)
+	}
+	return
+}
+
+// keepalive sends the keepalive of the session until it's done, the peer knows the session is alive even if there is no data
+func keepalive(conn net.Conn, session string, done chan struct{}) {
+	ticker := time.NewTicker(keepaliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			_, _ = conn.Write(controlFrame(keepalivePrefix, session, 0))
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package pkg
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchdog(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name    string
+		dog     *watchdog
+		idle    time.Duration
+		age     time.Duration
+		wantErr error
+	}{{
+		name: "nil never expires",
+	}, {
+		name: "active",
+		dog:  newWatchdog(context.Background(), "waiter", time.Minute, time.Hour),
+		idle: time.Second,
+		age:  time.Second,
+	}, {
+		name:    "idle for too long",
+		dog:     newWatchdog(context.Background(), "waiter", time.Minute, time.Hour),
+		idle:    2 * time.Minute,
+		age:     2 * time.Minute,
+		wantErr: ErrTimeout,
+	}, {
+		name:    "took too long",
+		dog:     newWatchdog(context.Background(), "waiter", time.Minute, time.Hour),
+		idle:    time.Second,
+		age:     2 * time.Hour,
+		wantErr: ErrTimeout,
+	}, {
+		name:    "cancelled",
+		dog:     newWatchdog(cancelled, "waiter", time.Minute, time.Hour),
+		idle:    time.Second,
+		age:     time.Second,
+		wantErr: ErrCancelled,
+	}, {
+		name: "no limit",
+		dog:  newWatchdog(context.Background(), "waiter", 0, 0),
+		idle: time.Hour,
+		age:  time.Hour,
+	}}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.dog != nil {
+				tt.dog.begin = time.Now().Add(-tt.age)
+				tt.dog.active.Store(time.Now().Add(-tt.idle).UnixNano())
+			}
+			err := tt.dog.check()
+			if tt.wantErr == nil {
+				assert.Nil(t, err, "failed in case [%d]", i)
+			} else {
+				assert.ErrorIs(t, err, tt.wantErr, "failed in case [%d]", i)
+			}
+
+			// a frame from the peer keeps it alive
+			tt.dog.touch()
+			if tt.dog != nil && tt.age < time.Hour && tt.wantErr != ErrCancelled {
+				assert.Nil(t, tt.dog.check(), "failed in case [%d]", i)
+			}
+		})
+	}
+}
+
+func TestKeepalive(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer func() {
+		_ = server.Close()
+	}()
+	conn, err := net.Dial("udp", server.LocalAddr().String())
+	assert.Nil(t, err)
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	done := make(chan struct{})
+	go keepalive(conn, "session1", done)
+	defer close(done)
+
+	message := make([]byte, 64)
+	_ = server.SetReadDeadline(time.Now().Add(2 * keepaliveInterval))
+	n, _, err := server.ReadFrom(message)
+	assert.Nil(t, err)
+	_, ok := parseControlFrame(message[:n], keepalivePrefix, "session1")
+	assert.True(t, ok)
+}
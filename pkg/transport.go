@@ -0,0 +1,257 @@
+package pkg
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// Transport creates the connections between the sender and the waiter.
+// All the connections keep the frame boundaries, it means each Write or WriteTo
+// sends a whole frame, and each Read or ReadFrom receives a whole frame.
+type Transport interface {
+	// Dial connects to the waiter
+	Dial(address string) (net.Conn, error)
+	// Listen listens to the frames from the senders
+	Listen(address string) (net.PacketConn, error)
+}
+
+// the supported transports
+const (
+	TransportAuto = "auto"
+	TransportUDP  = "udp"
+	TransportTCP  = "tcp"
+)
+
+// the probe frames which make sure the UDP packets could reach the waiter
+const (
+	probeRequest  = "ping"
+	probeResponse = "pong"
+)
+
+// NewTransport creates a transport by name
+func NewTransport(name string) (transport Transport, err error) {
+	switch name {
+	case TransportUDP:
+		transport = &UDPTransport{}
+	case TransportTCP:
+		transport = &TCPTransport{}
+	case TransportQUIC:
+		transport = &QUICTransport{}
+	case TransportAuto, "":
+		transport = &AutoTransport{ProbeTimeout: time.Second, ProbeCount: 3}
+	default:
+		err = fmt.Errorf("unsupported transport: '%s', should be one of %s, %s, %s, %s",
+			name, TransportAuto, TransportUDP, TransportTCP, TransportQUIC)
+	}
+	return
+}
+
+// socketBufferSize is the size of the send and receive buffers of a UDP socket, the chunks are dropped by
+// the kernel once the receive buffer is full. The OS might cap it, such as net.core.rmem_max on Linux.
+const socketBufferSize = 4 << 20
+
+// setSocketBuffers enlarges the send and receive buffers of the connection if it supports,
+// it's fine to keep the default ones if it fails
+func setSocketBuffers(conn interface{}) {
+	if c, ok := conn.(interface{ SetReadBuffer(int) error }); ok {
+		_ = c.SetReadBuffer(socketBufferSize)
+	}
+	if c, ok := conn.(interface{ SetWriteBuffer(int) error }); ok {
+		_ = c.SetWriteBuffer(socketBufferSize)
+	}
+}
+
+// chunkLimiter is a transport which adds its own bytes to each frame, so the chunks should be smaller
+type chunkLimiter interface {
+	chunkLimit() int
+}
+
+// chunkLimit returns the maximum chunk size of the transport, a frame of such a chunk fits a UDP datagram
+func chunkLimit(transport Transport) int {
+	if limiter, ok := transport.(chunkLimiter); ok {
+		return limiter.chunkLimit()
+	}
+	return maxChunk
+}
+
+// packetListener listens to the frames over an existing packet connection
+type packetListener interface {
+	ListenPacket(conn net.PacketConn) (net.PacketConn, error)
+}
+
+// UDPTransport sends each frame as a datagram, multiple datagrams are sent or received in one syscall on Linux
+type UDPTransport struct {
+	// Offload enables UDP GSO on the sender side, and GRO on the waiter side. It's Linux only.
+	Offload bool
+}
+
+// Dial connects to the waiter
+func (t *UDPTransport) Dial(address string) (conn net.Conn, err error) {
+	if conn, err = net.Dial("udp", address); err == nil {
+		setSocketBuffers(conn)
+		conn = newUDPConn(conn.(*net.UDPConn), t.Offload)
+	}
+	return
+}
+
+// Listen listens to the frames from the senders, and answers the probe requests
+func (t *UDPTransport) Listen(address string) (conn net.PacketConn, err error) {
+	if conn, err = net.ListenPacket("udp", address); err == nil {
+		conn, err = t.ListenPacket(conn)
+	}
+	return
+}
+
+// ListenPacket answers the probe requests over the existing connection
+func (t *UDPTransport) ListenPacket(conn net.PacketConn) (net.PacketConn, error) {
+	setSocketBuffers(conn)
+	responder := &probeResponder{PacketConn: conn}
+	if udpConn, ok := conn.(*net.UDPConn); ok {
+		if batch := newBatchConn(udpConn); batch != nil {
+			responder.batch = &batchReader{batch: batch, gro: t.Offload && enableGRO(udpConn)}
+		}
+	}
+	return responder, nil
+}
+
+// TCPTransport sends the frames over a TCP stream, each frame has a length prefix
+type TCPTransport struct{}
+
+// Dial connects to the waiter
+func (t *TCPTransport) Dial(address string) (conn net.Conn, err error) {
+	if conn, err = net.Dial("tcp", address); err == nil {
+		conn = newFramedConn(conn)
+	}
+	return
+}
+
+// Listen listens to the frames from the senders
+func (t *TCPTransport) Listen(address string) (conn net.PacketConn, err error) {
+	var listener net.Listener
+	if listener, err = net.Listen("tcp", address); err == nil {
+		conn = newStreamPacketConn(listener)
+	}
+	return
+}
+
+// AutoTransport prefers UDP, and falls back to TCP if the probe over UDP times out
+type AutoTransport struct {
+	ProbeTimeout time.Duration
+	ProbeCount   int
+}
+
+// Dial connects to the waiter
+func (t *AutoTransport) Dial(address string) (conn net.Conn, err error) {
+	udp := &UDPTransport{}
+	if conn, err = udp.Dial(address); err != nil {
+		return
+	}
+
+	if probe(conn, t.ProbeTimeout, t.ProbeCount) {
+		return
+	}
+	_ = conn.Close()
+	return (&TCPTransport{}).Dial(address)
+}
+
+// Listen listens to the frames from the senders over both UDP and TCP
+func (t *AutoTransport) Listen(address string) (conn net.PacketConn, err error) {
+	var udpConn, tcpConn net.PacketConn
+	if udpConn, err = (&UDPTransport{}).Listen(address); err != nil {
+		return
+	}
+	if tcpConn, err = (&TCPTransport{}).Listen(address); err != nil {
+		_ = udpConn.Close()
+		return
+	}
+	conn = newMultiPacketConn(udpConn, tcpConn)
+	return
+}
+
+// probe checks if the waiter could answer the probe request
+func probe(conn net.Conn, timeout time.Duration, count int) bool {
+	defer func() {
+		_ = conn.SetReadDeadline(time.Time{})
+	}()
+
+	message := make([]byte, 64)
+	for i := 0; i < count; i++ {
+		if _, err := conn.Write([]byte(probeRequest)); err != nil {
+			// the ICMP port unreachable message might come back
+			time.Sleep(timeout)
+			continue
+		}
+
+		_ = conn.SetReadDeadline(time.Now().Add(timeout))
+		if n, err := conn.Read(message); err == nil && string(message[:n]) == probeResponse {
+			return true
+		}
+	}
+	return false
+}
+
+// probeResponder answers the probe requests, and hides them from the reader
+type probeResponder struct {
+	net.PacketConn
+	batch *batchReader
+	// pending holds the coalesced datagrams which were not read
+	pending []ReceivedData
+}
+
+// ReadFrom reads a frame which is not a probe request
+func (c *probeResponder) ReadFrom(p []byte) (n int, addr net.Addr, err error) {
+	if c.batch == nil || !c.batch.gro {
+		for {
+			if n, addr, err = c.PacketConn.ReadFrom(p); err != nil || string(p[:n]) != probeRequest {
+				return
+			}
+			_, _ = c.PacketConn.WriteTo([]byte(probeResponse), addr)
+		}
+	}
+
+	// the datagrams might be coalesced by GRO
+	for len(c.pending) == 0 {
+		var frames []ReceivedData
+		if frames, _, err = c.ReadFrames([]*receiveBuffer{newReceiveBuffer(maxDatagramSize)}); err != nil {
+			return
+		}
+		c.pending = append(c.pending, frames...)
+	}
+	n, addr = copy(p, c.pending[0].Data), c.pending[0].Remote
+	c.pending = c.pending[1:]
+	return
+}
+
+// ReadFrames reads the frames which are not probe requests in batches
+func (c *probeResponder) ReadFrames(buffers []*receiveBuffer) (frames []ReceivedData, used int, err error) {
+	if len(c.pending) > 0 {
+		frames, c.pending = c.pending, nil
+		return
+	}
+
+	if c.batch == nil {
+		var n int
+		var addr net.Addr
+		if n, addr, err = c.ReadFrom(buffers[0].data); err == nil {
+			buffers[0].hold()
+			frames, used = []ReceivedData{{Data: buffers[0].data[:n], Remote: addr, buffer: buffers[0]}}, 1
+		}
+		return
+	}
+
+	var received []ReceivedData
+	if received, used, err = c.batch.read(buffers); err != nil {
+		return
+	}
+	frames = received[:0]
+	for _, frame := range received {
+		if string(frame.Data) == probeRequest {
+			_, _ = c.PacketConn.WriteTo([]byte(probeResponse), frame.Remote)
+			frame.release()
+		} else {
+			frames = append(frames, frame)
+		}
+	}
+	return
+}
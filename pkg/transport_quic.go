@@ -0,0 +1,182 @@
+package pkg
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// TransportQUIC sends the frames over a QUIC stream
+const TransportQUIC = "quic"
+
+// quicProtocol is the ALPN of the transfer protocol
+const quicProtocol = "transfer"
+
+// QUICTransport sends the frames over a QUIC stream, it brings TLS 1.3 and the congestion control.
+// The waiter generates a self-signed certificate when it starts, so the data is encrypted
+// but the sender does not verify the waiter.
+type QUICTransport struct{}
+
+// Dial connects to the waiter
+func (t *QUICTransport) Dial(address string) (conn net.Conn, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var connection quic.Connection
+	if connection, err = quic.DialAddr(ctx, address, &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{quicProtocol},
+	}, quicConfig()); err != nil {
+		return
+	}
+
+	var stream quic.Stream
+	if stream, err = connection.OpenStreamSync(ctx); err != nil {
+		_ = connection.CloseWithError(0, "")
+		return
+	}
+	conn = newFramedConn(&quicStreamConn{Stream: stream, connection: connection})
+	return
+}
+
+// Listen listens to the frames from the senders
+func (t *QUICTransport) Listen(address string) (conn net.PacketConn, err error) {
+	var packetConn net.PacketConn
+	if packetConn, err = net.ListenPacket("udp", address); err != nil {
+		return
+	}
+	if conn, err = t.ListenPacket(packetConn); err != nil {
+		_ = packetConn.Close()
+	}
+	return
+}
+
+// ListenPacket listens to the frames from the senders over the existing connection
+func (t *QUICTransport) ListenPacket(packetConn net.PacketConn) (conn net.PacketConn, err error) {
+	var certificate tls.Certificate
+	if certificate, err = selfSignedCertificate(); err != nil {
+		return
+	}
+
+	var listener *quic.Listener
+	if listener, err = quic.Listen(packetConn, &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		NextProtos:   []string{quicProtocol},
+	}, quicConfig()); err != nil {
+		return
+	}
+	conn = &quicPacketConn{
+		streamPacketConn: newStreamPacketConn(&quicListener{listener: listener}),
+		packetConn:       packetConn,
+	}
+	return
+}
+
+func quicConfig() *quic.Config {
+	return &quic.Config{
+		MaxIdleTimeout:  time.Minute,
+		KeepAlivePeriod: 10 * time.Second,
+	}
+}
+
+// quicListener accepts the first stream of each QUIC connection
+type quicListener struct {
+	listener *quic.Listener
+}
+
+// Accept waits for the next stream
+func (l *quicListener) Accept() (conn net.Conn, err error) {
+	for {
+		var connection quic.Connection
+		if connection, err = l.listener.Accept(context.Background()); err != nil {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		stream, streamErr := connection.AcceptStream(ctx)
+		cancel()
+		if streamErr != nil {
+			_ = connection.CloseWithError(0, "")
+			continue
+		}
+		conn = &quicStreamConn{Stream: stream, connection: connection}
+		return
+	}
+}
+
+// Close closes the listener
+func (l *quicListener) Close() error {
+	return l.listener.Close()
+}
+
+// Addr returns the listen address
+func (l *quicListener) Addr() net.Addr {
+	return l.listener.Addr()
+}
+
+// quicStreamConn makes a QUIC stream be a net.Conn
+type quicStreamConn struct {
+	quic.Stream
+	connection quic.Connection
+}
+
+// LocalAddr returns the local address of the connection
+func (c *quicStreamConn) LocalAddr() net.Addr {
+	return c.connection.LocalAddr()
+}
+
+// RemoteAddr returns the remote address of the connection
+func (c *quicStreamConn) RemoteAddr() net.Addr {
+	return c.connection.RemoteAddr()
+}
+
+// Close closes the stream and the connection
+func (c *quicStreamConn) Close() error {
+	_ = c.Stream.Close()
+	return c.connection.CloseWithError(0, "")
+}
+
+// quicPacketConn closes the underlying packet connection as well
+type quicPacketConn struct {
+	*streamPacketConn
+	packetConn net.PacketConn
+}
+
+// Close closes the listener and the underlying packet connection
+func (c *quicPacketConn) Close() (err error) {
+	err = c.streamPacketConn.Close()
+	_ = c.packetConn.Close()
+	return
+}
+
+func selfSignedCertificate() (certificate tls.Certificate, err error) {
+	var key *ecdsa.PrivateKey
+	if key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		return
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: quicProtocol},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	var der []byte
+	if der, err = x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key); err != nil {
+		return
+	}
+	certificate = tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	return
+}
@@ -0,0 +1,288 @@
+package pkg
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// RelayTransport connects the sender and the waiter via a relay server with a shared session code.
+// It tries the UDP hole punching first, then the frames are forwarded by the relay server if it fails.
+type RelayTransport struct {
+	Relay string
+	Code  string
+	// PunchTimeout is the duration of trying the UDP hole punching, skip it if it's zero
+	PunchTimeout time.Duration
+	// PeerTimeout is the duration of waiting for the waiter
+	PeerTimeout time.Duration
+}
+
+// NewRelayTransport creates an instance of RelayTransport
+func NewRelayTransport(relay, code string) *RelayTransport {
+	return &RelayTransport{
+		Relay:        relay,
+		Code:         code,
+		PunchTimeout: 3 * time.Second,
+		PeerTimeout:  time.Minute,
+	}
+}
+
+// Dial connects to the waiter which has the same session code, the address is ignored
+func (t *RelayTransport) Dial(string) (conn net.Conn, err error) {
+	var client *relayClient
+	if client, err = t.start(relayRoleSender); err != nil {
+		return
+	}
+
+	var peer *net.UDPAddr
+	for deadline := time.Now().Add(t.PeerTimeout); peer == nil; peer = client.peer.Load() {
+		if client.busy.Load() {
+			_ = client.Close()
+			err = client.busyError()
+			return
+		}
+		if time.Now().After(deadline) {
+			_ = client.Close()
+			err = fmt.Errorf("%w: no waiter with the session code '%s' in %v", ErrPeerNotFound, t.Code, t.PeerTimeout)
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	// give the hole punching a chance
+	for deadline := time.Now().Add(t.PunchTimeout); !client.direct.Load() && time.Now().Before(deadline); {
+		time.Sleep(100 * time.Millisecond)
+	}
+	conn = &relayConn{relayClient: client}
+	return
+}
+
+// chunkLimit leaves the room for the prefix of the frames which are forwarded by the relay server
+func (t *RelayTransport) chunkLimit() int {
+	return maxChunk - len(relayForward)
+}
+
+// Listen waits for the sender which has the same session code, the address is ignored
+func (t *RelayTransport) Listen(string) (conn net.PacketConn, err error) {
+	var client *relayClient
+	if client, err = t.start(relayRoleWaiter); err == nil {
+		conn = client
+	}
+	return
+}
+
+func (t *RelayTransport) start(role string) (client *relayClient, err error) {
+	var relay *net.UDPAddr
+	if relay, err = net.ResolveUDPAddr("udp", t.Relay); err != nil {
+		return
+	}
+
+	var conn *net.UDPConn
+	if conn, err = net.ListenUDP("udp", &net.UDPAddr{}); err != nil {
+		return
+	}
+
+	client = &relayClient{
+		conn:  conn,
+		relay: relay,
+		code:  t.Code,
+		role:  role,
+		punch: t.PunchTimeout > 0,
+		queue: newPacketQueue(),
+	}
+	go client.register()
+	go client.read()
+	return
+}
+
+// relayClient talks to the relay server, and to the other client directly once the hole punching works
+type relayClient struct {
+	conn   *net.UDPConn
+	relay  *net.UDPAddr
+	code   string
+	role   string
+	punch  bool
+	queue  *packetQueue
+	peer   atomic.Pointer[net.UDPAddr]
+	direct atomic.Bool
+	// busy means the relay server rejected the registration, the session code is paired already
+	busy atomic.Bool
+}
+
+// register keeps the registration and the NAT mapping alive
+func (c *relayClient) register() {
+	for {
+		if _, err := c.conn.WriteToUDP([]byte(fmt.Sprintf("%s %s %s", relayRegister, c.role, c.code)), c.relay); err != nil {
+			select {
+			case <-c.queue.closed:
+				return
+			default:
+			}
+		}
+
+		select {
+		case <-c.queue.closed:
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+func (c *relayClient) read() {
+	message := make([]byte, 65507)
+	for {
+		n, remote, err := c.conn.ReadFromUDP(message)
+		if err != nil {
+			select {
+			case <-c.queue.closed:
+				return
+			default:
+				continue
+			}
+		}
+
+		data := message[:n]
+		if remote.IP.Equal(c.relay.IP) && remote.Port == c.relay.Port {
+			c.handleRelay(data)
+		} else if peer := c.peer.Load(); peer != nil && remote.IP.Equal(peer.IP) && remote.Port == peer.Port {
+			c.handlePeer(data, peer)
+		}
+	}
+}
+
+func (c *relayClient) handleRelay(data []byte) {
+	message := string(data)
+	switch {
+	case strings.HasPrefix(message, relayPeer+" "):
+		peer, err := net.ResolveUDPAddr("udp", strings.TrimPrefix(message, relayPeer+" "))
+		if err != nil {
+			return
+		}
+		if old := c.peer.Swap(peer); old == nil || old.String() != peer.String() {
+			c.direct.Store(false)
+			if c.punch {
+				go c.punchHole(peer)
+			}
+		}
+	case message == relayBusy:
+		// there is no chance to be paired, the reading fails then
+		c.busy.Store(true)
+		c.queue.close()
+	case strings.HasPrefix(message, relayForward):
+		if peer := c.peer.Load(); peer != nil {
+			c.queue.push(packet{data: append([]byte{}, data[len(relayForward):]...), addr: peer})
+		}
+	}
+}
+
+func (c *relayClient) handlePeer(data []byte, peer *net.UDPAddr) {
+	switch string(data) {
+	case relayPunch:
+		_, _ = c.conn.WriteToUDP([]byte(relayPunched), peer)
+		c.direct.Store(true)
+	case relayPunched:
+		c.direct.Store(true)
+	default:
+		c.queue.push(packet{data: append([]byte{}, data...), addr: peer})
+	}
+}
+
+// punchHole sends the punch frames to the peer, both sides open the NAT mappings in this way
+func (c *relayClient) punchHole(peer *net.UDPAddr) {
+	for i := 0; i < 20 && !c.direct.Load(); i++ {
+		if current := c.peer.Load(); current == nil || current.String() != peer.String() {
+			return
+		}
+		_, _ = c.conn.WriteToUDP([]byte(relayPunch), peer)
+		time.Sleep(150 * time.Millisecond)
+	}
+}
+
+func (c *relayClient) write(p []byte) (n int, err error) {
+	peer := c.peer.Load()
+	if peer == nil {
+		err = fmt.Errorf("the peer of session '%s' is not ready", c.code)
+		return
+	}
+
+	if c.direct.Load() {
+		_, err = c.conn.WriteToUDP(p, peer)
+	} else {
+		_, err = c.conn.WriteToUDP(append([]byte(relayForward), p...), c.relay)
+	}
+	if err == nil {
+		n = len(p)
+	}
+	return
+}
+
+// busyError is the error of a session code which is paired already
+func (c *relayClient) busyError() error {
+	return fmt.Errorf("%w: the session code '%s' is in use by another sender and waiter", ErrPeerNotFound, c.code)
+}
+
+// ReadFrom reads a frame from the peer
+func (c *relayClient) ReadFrom(p []byte) (n int, addr net.Addr, err error) {
+	var frame packet
+	if frame, err = c.queue.pop(); err == nil {
+		n, addr = copy(p, frame.data), frame.addr
+	} else if c.busy.Load() {
+		err = c.busyError()
+	}
+	return
+}
+
+// WriteTo writes a frame to the peer, the address is ignored because there's only one peer
+func (c *relayClient) WriteTo(p []byte, _ net.Addr) (int, error) {
+	return c.write(p)
+}
+
+// Close closes the connection
+func (c *relayClient) Close() error {
+	c.queue.close()
+	return c.conn.Close()
+}
+
+// LocalAddr returns the local address
+func (c *relayClient) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// SetDeadline sets the read deadline only
+func (c *relayClient) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline
+func (c *relayClient) SetReadDeadline(t time.Time) error {
+	c.queue.setDeadline(t)
+	return nil
+}
+
+// SetWriteDeadline sets the write deadline
+func (c *relayClient) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+// relayConn is the sender side connection
+type relayConn struct {
+	*relayClient
+}
+
+// Read reads a frame from the waiter
+func (c *relayConn) Read(p []byte) (n int, err error) {
+	n, _, err = c.ReadFrom(p)
+	return
+}
+
+// Write writes a frame to the waiter
+func (c *relayConn) Write(p []byte) (int, error) {
+	return c.write(p)
+}
+
+// RemoteAddr returns the address of the waiter
+func (c *relayConn) RemoteAddr() net.Addr {
+	return c.peer.Load()
+}
@@ -0,0 +1,184 @@
+package pkg
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTransport(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Transport
+		wantErr bool
+	}{{
+		name: TransportUDP,
+		want: &UDPTransport{},
+	}, {
+		name: TransportTCP,
+		want: &TCPTransport{},
+	}, {
+		name: TransportAuto,
+		want: &AutoTransport{ProbeTimeout: time.Second, ProbeCount: 3},
+	}, {
+		name: TransportQUIC,
+		want: &QUICTransport{},
+	}, {
+		name:    "fake",
+		wantErr: true,
+	}}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport, err := NewTransport(tt.name)
+			assert.Equal(t, tt.wantErr, err != nil, "failed in case [%d]", i)
+			assert.Equal(t, tt.want, transport, "failed in case [%d]", i)
+		})
+	}
+}
+
+func TestTransport(t *testing.T) {
+	tests := []struct {
+		name      string
+		listener  Transport
+		dialer    Transport
+		wantProbe bool
+	}{{
+		name:     "udp",
+		listener: &UDPTransport{},
+		dialer:   &UDPTransport{},
+	}, {
+		name:     "tcp",
+		listener: &TCPTransport{},
+		dialer:   &TCPTransport{},
+	}, {
+		name:     "quic",
+		listener: &QUICTransport{},
+		dialer:   &QUICTransport{},
+	}, {
+		name:     "auto falls back to tcp",
+		listener: &TCPTransport{},
+		dialer:   &AutoTransport{ProbeTimeout: 100 * time.Millisecond, ProbeCount: 2},
+	}, {
+		name:      "auto with udp",
+		listener:  &AutoTransport{},
+		dialer:    &AutoTransport{ProbeTimeout: 100 * time.Millisecond, ProbeCount: 2},
+		wantProbe: true,
+	}}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := tt.listener.Listen(freeUDPAddress(t))
+			assert.Nil(t, err, "failed in case [%d]", i)
+			defer func() {
+				_ = server.Close()
+			}()
+
+			client, err := tt.dialer.Dial(server.LocalAddr().String())
+			assert.Nil(t, err, "failed in case [%d]", i)
+			defer func() {
+				_ = client.Close()
+			}()
+
+			if tt.wantProbe {
+				assert.True(t, probe(client, time.Second, 3), "failed in case [%d]", i)
+			}
+
+			// the frame boundaries should be kept
+			for _, frame := range []string{"hello", "world"} {
+				_, err = client.Write([]byte(frame))
+				assert.Nil(t, err, "failed in case [%d]", i)
+			}
+
+			message := make([]byte, 1024)
+			var remote net.Addr
+			for _, frame := range []string{"hello", "world"} {
+				_ = server.SetReadDeadline(time.Now().Add(time.Second))
+				var n int
+				n, remote, err = server.ReadFrom(message)
+				assert.Nil(t, err, "failed in case [%d]", i)
+				assert.Equal(t, frame, string(message[:n]), "failed in case [%d]", i)
+			}
+
+			_, err = server.WriteTo([]byte("done"), remote)
+			assert.Nil(t, err, "failed in case [%d]", i)
+			_ = client.SetReadDeadline(time.Now().Add(time.Second))
+			n, err := client.Read(message)
+			assert.Nil(t, err, "failed in case [%d]", i)
+			assert.Equal(t, "done", string(message[:n]), "failed in case [%d]", i)
+
+			// read timeout
+			_ = server.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+			_, _, err = server.ReadFrom(message)
+			if assert.NotNil(t, err, "failed in case [%d]", i) {
+				assert.True(t, err.(net.Error).Timeout(), "failed in case [%d]", i)
+			}
+		})
+	}
+}
+
+func TestProbeWithoutResponder(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer func() {
+		_ = server.Close()
+	}()
+
+	client, err := net.Dial("udp", server.LocalAddr().String())
+	assert.Nil(t, err)
+	assert.False(t, probe(client, 10*time.Millisecond, 2))
+}
+
+func TestReadFrame(t *testing.T) {
+	tests := []struct {
+		name    string
+		stream  string
+		want    []byte
+		wantErr bool
+	}{{
+		name:   "normal",
+		stream: "         5hello",
+		want:   []byte("hello"),
+	}, {
+		name:    "invalid length",
+		stream:  "     hello",
+		wantErr: true,
+	}, {
+		name:    "negative length",
+		stream:  "        -1",
+		wantErr: true,
+	}, {
+		name:    "oversized",
+		stream:  "9999999999",
+		wantErr: true,
+	}, {
+		name:    "bigger than a datagram",
+		stream:  fillContainerWithNumber(maxDatagramSize+1, frameHeaderLength),
+		wantErr: true,
+	}, {
+		name:    "truncated",
+		stream:  "         5he",
+		wantErr: true,
+	}}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := readFrame(strings.NewReader(tt.stream))
+			assert.Equal(t, tt.wantErr, err != nil, "failed in case [%d]", i)
+			if !tt.wantErr {
+				assert.Equal(t, tt.want, data, "failed in case [%d]", i)
+			}
+		})
+	}
+}
+
+func TestChunkLimit(t *testing.T) {
+	assert.Equal(t, maxChunk, chunkLimit(&UDPTransport{}))
+	// a relayed frame has a prefix, it still fits the maximum UDP payload
+	relay := NewRelayTransport("127.0.0.1:1", "code")
+	assert.Equal(t, 65507, len(relayForward)+headerLength+chunkLimit(relay))
+
+	err := NewUDPSender("127.0.0.1").WithTransport(relay).WithChunk(maxChunk).
+		SendReader(make(chan string, 10), "hello", strings.NewReader("hello"), 5)
+	assert.ErrorContains(t, err, "invalid chunk size")
+}
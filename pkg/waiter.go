@@ -1,178 +1,728 @@
 package pkg
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"os"
+	"path/filepath"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // UDPWaiter represents a UDP component for receiving data
 type UDPWaiter struct {
-	port   int
-	listen string
+	port        int
+	parallel    int
+	listen      string
+	transport   Transport
+	outputDir   string
+	preallocate bool
+	quota       int64
+	secret      string
+	trusted     []*net.IPNet
+	// idleTimeout and timeout fail the session if the sender is gone, or it takes too long
+	idleTimeout time.Duration
+	timeout     time.Duration
+	ctx         context.Context
+	events      emitter
+	summary     Summary
 
+	ring         *bufferRing
 	receivedData chan ReceivedData
 	eof          chan interface{}
 }
 
-// ReceivedData is the data read from UDP
+const (
+	// receiveBufferCount is the count of the datagrams which are received but not written
+	receiveBufferCount = 512
+	// writerCount is the count of the goroutines which write the data into the file
+	writerCount = 4
+	// loadInterval is the interval of reporting the load to the sender
+	loadInterval = 100 * time.Millisecond
+	// missInterval is the interval of checking the missing chunks, they are asked for once the data stops arriving
+	missInterval = 100 * time.Millisecond
+	// missBackoff is the time to wait for a requested chunk before asking for it again, it doubles each time
+	missBackoff = 500 * time.Millisecond
+	// maxMissBackoff is the longest time to wait for a requested chunk
+	maxMissBackoff = 8 * time.Second
+)
+
+// ReceivedData is the data read from the transport
 type ReceivedData struct {
 	Data   []byte
-	Remote *net.UDPAddr
+	Remote net.Addr
+
+	// buffer holds the data, it's reused once the data was released
+	buffer *receiveBuffer
+}
+
+// release gives back the buffer of the data
+func (d ReceivedData) release() {
+	d.buffer.release()
 }
 
 // NewUDPWaiter creates an instance of NewUDPWaiter
 func NewUDPWaiter(port int) *UDPWaiter {
 	return &UDPWaiter{
 		port:         port,
-		listen:       "0.0.0.0",
-		receivedData: make(chan ReceivedData, 1024),
+		parallel:     1,
+		listen:       "",
+		transport:    &UDPTransport{},
+		idleTimeout:  DefaultIdleTimeout,
+		ctx:          context.Background(),
+		ring:         newBufferRing(receiveBufferCount, maxDatagramSize),
+		receivedData: make(chan ReceivedData, receiveBufferCount),
 		eof:          make(chan interface{}),
 	}
 }
 
-// ListenAddress set the listen address
+// ListenAddress set the listen address, listen to all the IPv4 and IPv6 addresses if it's empty
 func (w *UDPWaiter) ListenAddress(address string) *UDPWaiter {
 	w.listen = address
 	return w
 }
 
+// WithOutputDir sets the directory to write the files, it's the current directory by default
+func (w *UDPWaiter) WithOutputDir(dir string) *UDPWaiter {
+	w.outputDir = dir
+	return w
+}
+
+// WithPreallocate allocates the disk space of the whole file before receiving, the file is sparse by default
+func (w *UDPWaiter) WithPreallocate(preallocate bool) *UDPWaiter {
+	w.preallocate = preallocate
+	return w
+}
+
+// WithQuota sets the maximum size of a file to receive, it's not limited if it's zero
+func (w *UDPWaiter) WithQuota(quota int64) *UDPWaiter {
+	w.quota = quota
+	return w
+}
+
+// WithSecret sets the shared secret, the sender should sign the session with the same one
+func (w *UDPWaiter) WithSecret(secret string) *UDPWaiter {
+	w.secret = secret
+	return w
+}
+
+// WithTrustedPeers accepts the offers from the addresses of the networks only, any sender is accepted if it's empty
+func (w *UDPWaiter) WithTrustedPeers(trusted []*net.IPNet) *UDPWaiter {
+	w.trusted = trusted
+	return w
+}
+
+// WithIdleTimeout fails the session if there is no frame from the sender in the duration, zero means no limit
+func (w *UDPWaiter) WithIdleTimeout(timeout time.Duration) *UDPWaiter {
+	w.idleTimeout = timeout
+	return w
+}
+
+// WithTimeout fails the session if it takes longer than the duration since the offer was accepted, zero means no limit
+func (w *UDPWaiter) WithTimeout(timeout time.Duration) *UDPWaiter {
+	w.timeout = timeout
+	return w
+}
+
+// WithContext cancels the session once the context is done, Start returns ErrCancelled then
+func (w *UDPWaiter) WithContext(ctx context.Context) *UDPWaiter {
+	w.ctx = ctx
+	return w
+}
+
+// WithEvents sends the events of the session to the channel, it's closed once the session is over
+func (w *UDPWaiter) WithEvents(events chan Event) *UDPWaiter {
+	w.events = events
+	return w
+}
+
+// WithTransport sets the transport, it's UDP by default
+func (w *UDPWaiter) WithTransport(transport Transport) *UDPWaiter {
+	w.transport = transport
+	return w
+}
+
+// WithParallel sets the count of the ports to listen, they start from the port one by one
+func (w *UDPWaiter) WithParallel(parallel int) *UDPWaiter {
+	if parallel > 0 {
+		w.parallel = parallel
+	}
+	return w
+}
+
 // Start starts UDP connection
 func (w *UDPWaiter) Start(msg chan string) (err error) {
-	udpAddress := &net.UDPAddr{
-		Port: w.port,
-		IP:   net.ParseIP(w.listen),
-	}
 	defer close(msg)
+	defer w.events.close()
 
-	conn, err := net.ListenUDP("udp", udpAddress)
-	if err != nil {
+	var target, sum string
+	var size, requests int64
+	var in *Incoming
+	begin := time.Now()
+	defer func() {
+		var written int64
+		if in != nil {
+			written = in.written
+		}
+		if err != nil {
+			sum = ""
+		}
+		w.summary = newSummary(target, written, time.Since(begin), requests, sum)
+	}()
+
+	if in, err = w.accept(msg); err != nil {
 		return err
 	}
 	defer func() {
-		_ = conn.Close()
+		err = in.close(err)
 	}()
 
-	msg <- fmt.Sprintf("server listening %s\n", conn.LocalAddr().String())
-	header, err := readHeader(conn)
+	// never write the file out of the output directory
+	target, size = filepath.Join(w.outputDir, in.Metadata.Name), in.Size
+	f, output, err := in.create(target)
 	if err != nil {
 		return err
 	}
-	msg <- fmt.Sprintf("start to receive data from %v\n", header.remote)
+	defer func() {
+		_ = f.Close()
+	}()
 
-	f, err := os.OpenFile(header.filename, os.O_WRONLY|os.O_CREATE, 0640)
-	if err != nil {
+	begin = time.Now()
+	if sum, requests, err = in.receiveFile(f, output, target); err != nil {
 		return err
 	}
+	msg <- "done with checking\n"
+	msg <- fmt.Sprintf("wrote to file %s\n", target)
+	w.events.emit(Event{Type: EventComplete, File: target, Size: size, Bytes: size, Checksum: sum})
+	return
+}
+
+// create opens the file to write, the offer is rejected if it fails. The existing file is kept until the delta
+// is written into a temporary file, the output is the path of the temporary one then.
+func (in *Incoming) create(target string) (f *os.File, output string, err error) {
+	w := in.waiter
+	output, existing := target, target
+	if _, statErr := os.Stat(target); statErr == nil && in.offer.supports(FeatureDelta) {
+		output, existing = target+deltaSuffix, ""
+	}
 	defer func() {
+		if err != nil {
+			_ = in.reject(err)
+		}
+	}()
+	if err = checkSpace(filepath.Dir(target), existing, in.Size, w.quota); err != nil {
+		return
+	}
+
+	// the file is read for the checksum at the end
+	if f, err = os.OpenFile(output, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0640); err != nil {
+		return
+	}
+	if err = allocateFile(f, in.Size, w.preallocate); err != nil {
+		_ = f.Close()
+		f, err = nil, fmt.Errorf("failed to init file, %w", diskError(err))
+	}
+	return
+}
+
+// receiveFile writes the chunks into the file which is created by create, the chunks of the delta are copied
+// from the target. The temporary file replaces the target once it's done, or it's removed if the checksum mismatches.
+func (in *Incoming) receiveFile(f *os.File, output, target string) (sum string, requests int64, err error) {
+	// the target is the file which is being written if there was no such file, never copy the blocks from it
+	original := ""
+	if output != target {
+		original = target
+	}
+	if sum, requests, err = in.receive(target, &chunkWriter{f: f, sparse: true}, original); errors.Is(err, ErrChecksumMismatch) {
+		// never leave a broken file
 		_ = f.Close()
+		_ = os.Remove(output)
+		return
+	} else if err != nil {
+		return
+	}
+
+	if output != target {
+		if err = f.Close(); err == nil {
+			err = os.Rename(output, target)
+		}
+	}
+	return
+}
+
+// accept listens to the ports and waits for an offer, the offer is rejected if it fails to verify.
+// The messages are not sent if the channel is nil.
+func (w *UDPWaiter) accept(msg chan string) (in *Incoming, err error) {
+	conn, err := w.transport.Listen(net.JoinHostPort(w.listen, strconv.Itoa(w.port)))
+	if err != nil {
+		return
+	}
+	in = &Incoming{waiter: w, conn: conn}
+	// the blocking reads return once the connections are closed
+	in.stop = context.AfterFunc(w.ctx, func() {
+		_ = conn.Close()
+	})
+	defer func() {
+		if err != nil {
+			err = in.close(err)
+			in = nil
+		}
 	}()
 
-	if _, err = f.Write(make([]byte, header.length)); err != nil {
-		err = fmt.Errorf("failed to init file, %v", err)
-		return err
+	// the extra ports receive the data only, the missing requests are sent through the first one
+	if in.extra, err = w.listenExtraPorts(); err != nil {
+		return
 	}
 
+	notify(msg, fmt.Sprintf("server listening %s\n", conn.LocalAddr().String()))
+	if in.extra != nil {
+		notify(msg, fmt.Sprintf("server listening %d more ports from %d\n", w.parallel-1, w.port+1))
+	}
+	if in.offer, in.Peer, err = readOffer(conn); err != nil {
+		return
+	}
+	notify(msg, fmt.Sprintf("start to receive data from %v\n", in.Peer))
+	if err = checkTrusted(in.Peer, w.trusted); err != nil {
+		_ = in.reject(err)
+		return
+	}
+	if err = in.offer.verify(w.secret, w.parallel, chunkLimit(w.transport)); err != nil {
+		_ = in.reject(err)
+		return
+	}
+
+	in.header = in.offer.header(in.Peer)
+	in.Metadata = Metadata{Name: filepath.Base(in.header.filename)}
+	in.Size = int64(in.header.length)
+	return
+}
+
+// receive accepts the offer and writes the chunks until the FIN is acknowledged, the block sums of the original file
+// are sent if the sender asks for them. The checksum is empty if the writer could not be read.
+func (in *Incoming) receive(file string, writer *chunkWriter, original string) (sum string, requests int64, err error) {
+	w, conn, header := in.waiter, in.conn, in.header
+	_ = replyAccept(conn, in.Peer, in.offer.Session)
+	dog := newWatchdog(w.ctx, "sender", w.idleTimeout, w.timeout)
+	w.events.emit(Event{Type: EventStart, File: file, Size: in.Size, Peer: in.Peer.String()})
+
 	mapBuffer := NewSafeMap(header.count)
+	written := func() int64 {
+		return min(int64(header.count-mapBuffer.Size())*int64(header.chrunk), in.Size)
+	}
+	defer func() {
+		in.written = written()
+	}()
+	progressDone := make(chan struct{})
+	progress := sync.WaitGroup{}
+	progress.Add(1)
 	go func() {
-		if _, err := f.WriteAt(header.data, int64(header.chrunk*header.index)); err == nil {
-			mapBuffer.Remove(header.index)
+		defer progress.Done()
+		w.events.reportProgress(file, in.Size, written, progressDone)
+	}()
+	defer func() {
+		close(progressDone)
+		progress.Wait()
+	}()
+
+	writer.session, writer.mapBuffer = in.offer.Session, mapBuffer
+	defer func() {
+		if writer.original != nil {
+			_ = writer.original.Close()
 		}
 	}()
+	if header.count > 0 {
+		var first dataHeader
+		if first, err = w.prepare(conn, in.offer, original, writer, dog); err != nil {
+			return
+		}
+		_ = writer.write(first)
+	}
+
+	if in.extra != nil {
+		go w.receive(in.extra, dog)
+	}
 
 	wg := sync.WaitGroup{}
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 
-		//startedMissingThread := false
-		for size := mapBuffer.Size(); size > 0; size = mapBuffer.Size() {
-			message := make([]byte, 65507)
-			data := ReceivedData{}
-			var (
-				rlen    int
-				readErr error
-			)
-			if rlen, data.Remote, readErr = conn.ReadFromUDP(message[:]); readErr == nil {
-				data.Data = message[:rlen]
-				w.receivedData <- data
+		w.receive(conn, dog)
+		// notify the session is over
+		close(w.eof)
+	}()
+
+	// the sender slows down once the buffers are running out
+	go reportLoad(conn, header.remote, header.session, w.ring, w.eof)
+
+	fin := newCompletion(header.session)
+	for i := 0; i < writerCount; i++ {
+		go w.write(writer, fin)
+	}
+
+	requests, failure := sendWaitingMissingRequest(&header, mapBuffer, writer, conn, dog)
+	if errors.Is(failure, ErrTimeout) || errors.Is(failure, ErrCancelled) || errors.Is(failure, ErrSendFailed) {
+		// nobody acknowledges the FIN
+		_ = conn.Close()
+		wg.Wait()
+		err = failure
+		return
+	}
+	if reader, ok := writer.f.(io.ReaderAt); ok && failure == nil {
+		sum, failure = checksum(reader, in.Size)
+	}
+	// both sides agree on the result once the FIN is acknowledged
+	err = fin.finish(conn, header.remote, failure, sum)
+	_ = conn.Close()
+	wg.Wait()
+	if failure != nil {
+		err = failure
+	}
+	return
+}
+
+// Summary returns the result of the last session
+func (w *UDPWaiter) Summary() Summary {
+	return w.summary
+}
+
+// prepare answers the frames before the data, they are the offers which are sent again if the answer was lost,
+// and the requests of the block sums of the existing file. It returns the first chunk.
+func (w *UDPWaiter) prepare(conn net.PacketConn, o offer, target string, writer *chunkWriter, dog *watchdog) (first dataHeader, err error) {
+	defer func() {
+		_ = conn.SetReadDeadline(time.Time{})
+	}()
+
+	var sums []blockSum
+	summed := false
+	message := make([]byte, maxDatagramSize)
+	for {
+		data := ReceivedData{Data: message}
+		var n int
+		_ = conn.SetReadDeadline(time.Now().Add(pollInterval))
+		if n, data.Remote, err = conn.ReadFrom(message); errors.Is(err, os.ErrDeadlineExceeded) {
+			if err = dog.check(); err != nil {
+				return
 			}
+			continue
+		} else if err != nil {
+			return
 		}
-		// notify all the data was received
-		w.eof <- nil
-	}()
+		dog.touch()
+		data.Data = message[:n]
 
-	// start a thread to write the data
-	go func() {
-		for {
+		if resent, ok := parseOffer(data.Data); ok {
+			if resent.Session == o.Session {
+				_ = replyAccept(conn, data.Remote, o.Session)
+			}
+			continue
+		}
+		if aborted, abortErr := checkAbort(data.Data, o.Session); aborted {
+			err = abortErr
+			return
+		}
+
+		var header dataHeader
+		if header, err = readHeaderFromData(data); err != nil || header.session != o.Session {
+			// the chunks of other sessions might be delayed from a previous run
+			continue
+		}
+		if header.codec != codecSums {
+			first = header
+			return
+		}
+
+		if !summed {
+			if writer.original, sums, err = existingSums(target, o.Chunk); err != nil {
+				return
+			}
+			summed = true
+		}
+		replySums(conn, data.Remote, sums, o.Session)
+	}
+}
+
+// listenExtraPorts listens to the ports after the first one, returns nil if there's only one port
+func (w *UDPWaiter) listenExtraPorts() (conn net.PacketConn, err error) {
+	if w.parallel <= 1 {
+		return
+	}
+
+	conns := make([]net.PacketConn, 0, w.parallel-1)
+	for i := 1; i < w.parallel; i++ {
+		var extra net.PacketConn
+		if extra, err = w.transport.Listen(net.JoinHostPort(w.listen, strconv.Itoa(w.port+i))); err != nil {
+			for _, c := range conns {
+				_ = c.Close()
+			}
+			return
+		}
+		conns = append(conns, extra)
+	}
+	conn = newMultiPacketConn(conns...)
+	return
+}
+
+// receive reads the data until the connection was closed, multiple datagrams are read at once if possible.
+// Any frame keeps the session alive, including the keepalive.
+func (w *UDPWaiter) receive(conn net.PacketConn, dog *watchdog) {
+	reader := newFrameReader(conn, w.ring)
+	for {
+		frames, readErr := reader.read()
+		if errors.Is(readErr, net.ErrClosed) {
+			return
+		}
+		if len(frames) > 0 {
+			dog.touch()
+		}
+		for _, data := range frames {
 			select {
+			case w.receivedData <- data:
 			case <-w.eof:
+				data.release()
 				return
-			case data := <-w.receivedData:
-				writeData(data, f, mapBuffer)
 			}
 		}
-	}()
+	}
+}
 
-	// check the buffer and start the missing thread
-	lastCount := 0
-	time.Sleep(time.Microsecond * time.Duration(lastCount) * 50)
-	for lastCount != mapBuffer.Size() {
-		lastCount = mapBuffer.Size()
-		time.Sleep(time.Second * 5)
+// write writes the received data into the file until the session is over, the FIN-ACK goes to the completion,
+// and the abort of the sender fails the session
+func (w *UDPWaiter) write(writer *chunkWriter, fin *completion) {
+	for {
+		select {
+		case <-w.eof:
+			return
+		case data := <-w.receivedData:
+			if header, err := readHeaderFromData(data); err == nil {
+				_ = writer.write(header)
+			} else if aborted, abortErr := checkAbort(data.Data, writer.session); aborted {
+				writer.fail(abortErr)
+			} else {
+				fin.acknowledge(data.Data)
+			}
+			data.release()
+		}
 	}
-	sendWaitingMissingRequest(&wg, &header, mapBuffer, conn, msg)
+}
 
-	wg.Wait()
-	msg <- fmt.Sprintf("wrote to file %s\n", f.Name())
+// reportLoad tells the sender the percentage of the receive buffers which are in use
+func reportLoad(conn net.PacketConn, remote net.Addr, session string, ring *bufferRing, done chan interface{}) {
+	ticker := time.NewTicker(loadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			_, _ = conn.WriteTo(controlFrame("load", session, ring.load()), remote)
+		}
+	}
+}
+
+// chunkWriter writes the chunks of a session into the file, the copied chunks are read from the original file
+type chunkWriter struct {
+	f        io.WriterAt
+	original *os.File
+	// sparse means the file was truncated to the size, the zeros of the holes are there already
+	sparse    bool
+	session   string
+	mapBuffer *SafeMap
+	// failed is the first error of writing the file, the session fails with it
+	failed atomic.Pointer[error]
+}
+
+// fail records the error of writing the file
+func (w *chunkWriter) fail(err error) {
+	w.failed.CompareAndSwap(nil, &err)
+}
+
+// failure returns the first error of writing the file
+func (w *chunkWriter) failure() (err error) {
+	if failed := w.failed.Load(); failed != nil {
+		err = *failed
+	}
 	return
 }
 
-func writeData(data ReceivedData, f *os.File, mapBuffer *SafeMap) {
-	header, err := readHeaderFromData(data)
-	if err == nil {
-		_, err = f.WriteAt(header.data, int64(header.chrunk*header.index))
-		if err == nil {
-			mapBuffer.Remove(header.index)
+// write writes a chunk at its offset, it's decompressed or copied first if necessary.
+// The chunks of other sessions are discarded.
+func (w *chunkWriter) write(header dataHeader) (err error) {
+	if header.session != w.session {
+		err = fmt.Errorf("unknown session %q", header.session)
+		return
+	}
+
+	switch header.codec {
+	case 0:
+	case codecSums:
+		// the sender asked for the sums again, but it has got them already
+		return
+	case codecHole:
+		if w.sparse {
+			w.mapBuffer.Remove(header.index)
+			return
+		}
+		// the last chunk is shorter than the others
+		offset := int64(header.chrunk) * int64(header.index)
+		header.data = zeroChunk[:max(min(int64(header.chrunk), int64(header.length)-offset), 0)]
+	default:
+		buf := decompressPool.Get().(*[]byte)
+		defer decompressPool.Put(buf)
+		if cap(*buf) < header.chrunk {
+			*buf = make([]byte, header.chrunk)
 		}
+		if header.codec == codecCopy {
+			header.data, err = w.copyBlock(header.data, (*buf)[:header.chrunk])
+		} else {
+			header.data, err = decompress(header.codec, header.data, (*buf)[:header.chrunk])
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	if _, err = w.f.WriteAt(header.data, int64(header.chrunk)*int64(header.index)); err == nil {
+		w.mapBuffer.Remove(header.index)
+	} else {
+		w.fail(diskError(err))
 	}
+	return
 }
 
-func sendWaitingMissingRequest(wg *sync.WaitGroup, header *dataHeader, buffer *SafeMap, conn *net.UDPConn, msg chan string) {
-	wg.Add(1)
-	go func() {
-		defer func() {
-			_ = conn.Close()
-			wg.Done()
-		}()
-
-		for buffer.Size() > 0 {
-			missing := buffer.GetKeys()
-			//fmt.Println("missing", len(missing))
-			for _, i := range missing {
-				_ = requestMissing(conn, i, header.remote)
+// copyBlock reads a block of the original file, the data is the index of the block
+func (w *chunkWriter) copyBlock(data, buf []byte) (result []byte, err error) {
+	if w.original == nil {
+		err = fmt.Errorf("no original file to copy from")
+		w.fail(err)
+		return
+	}
+
+	var index, n int
+	if index, err = strconv.Atoi(string(data)); err != nil {
+		return
+	}
+	if n, err = w.original.ReadAt(buf, int64(index)*int64(len(buf))); errors.Is(err, io.EOF) && n > 0 {
+		// the last block is shorter than the others
+		err = nil
+	}
+	if err != nil {
+		w.fail(fmt.Errorf("failed to copy the block %d of the original file, %v", index, err))
+	}
+	result = buf[:n]
+	return
+}
+
+// decompressPool holds the buffers for the decompressed chunks
+var decompressPool = sync.Pool{
+	New: func() interface{} {
+		return new([]byte)
+	},
+}
+
+// sendWaitingMissingRequest asks for the missing chunks until all of them were written,
+// or it failed to write the file, or the session was expired. It returns the count of the requests.
+// The chunks are asked for once the data stops arriving, and a requested chunk is not asked for again
+// until its backoff is over, so the sender does not send the chunks which are on the way again.
+func sendWaitingMissingRequest(header *dataHeader, buffer *SafeMap, writer *chunkWriter, conn net.PacketConn, dog *watchdog) (requests int64, err error) {
+	ticker := time.NewTicker(missInterval)
+	defer ticker.Stop()
+
+	requested := map[int]*missRequest{}
+	for last := -1; buffer.Size() > 0; <-ticker.C {
+		if err = writer.failure(); err != nil {
+			return
+		}
+		if err = dog.check(); err != nil {
+			return
+		}
+
+		// the data is still arriving
+		if size := buffer.Size(); size != last {
+			last = size
+			continue
+		}
+
+		now := time.Now()
+		for _, i := range buffer.GetKeys() {
+			if requested[i] == nil {
+				requested[i] = &missRequest{}
+			}
+			if requested[i].due(now) {
+				_ = requestMissing(conn, i, header.remote, header.session)
+				requests++
 			}
-			time.Sleep(time.Second)
 		}
+	}
+	return
+}
+
+// missRequest is the backoff of asking for a missing chunk
+type missRequest struct {
+	next    time.Time
+	backoff time.Duration
+}
 
-		for err := requestDone(conn, header.remote); err != nil; {
+// due returns true if it's time to ask for the chunk, the next time is delayed by the backoff then
+func (r *missRequest) due(now time.Time) bool {
+	if now.Before(r.next) {
+		return false
+	}
+	r.backoff = min(max(r.backoff*2, missBackoff), maxMissBackoff)
+	r.next = now.Add(r.backoff)
+	return true
+}
+
+// ParseTrustedPeers parses the IP addresses or the CIDR networks, such as: 192.168.1.2, 192.168.1.0/24
+func ParseTrustedPeers(peers []string) (trusted []*net.IPNet, err error) {
+	for _, peer := range peers {
+		var network *net.IPNet
+		if ip := net.ParseIP(peer); ip != nil {
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			network = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+		} else if _, network, err = net.ParseCIDR(peer); err != nil {
+			err = fmt.Errorf("invalid trusted peer: '%s', it should be an IP address or a CIDR network", peer)
+			return
 		}
-		msg <- "done with checking\n"
-	}()
+		trusted = append(trusted, network)
+	}
+	return
 }
 
-func requestDone(conn *net.UDPConn, remote *net.UDPAddr) (err error) {
-	for i := 0; i < 3; i++ {
-		_, err = conn.WriteTo([]byte("done"+fillContainerWithNumber(0, 10)), remote)
+// checkTrusted makes sure the address is in one of the trusted networks, any address is trusted if there is none
+func checkTrusted(addr net.Addr, trusted []*net.IPNet) (err error) {
+	if len(trusted) == 0 {
+		return
+	}
 
-		time.Sleep(time.Second)
+	host, _, _ := net.SplitHostPort(addr.String())
+	if ip := net.ParseIP(host); ip != nil {
+		for _, network := range trusted {
+			if network.Contains(ip) {
+				return
+			}
+		}
 	}
+	err = fmt.Errorf("the sender %s is not a trusted peer", host)
 	return
 }
 
-func requestMissing(conn *net.UDPConn, index int, remote *net.UDPAddr) (err error) {
-	_, err = conn.WriteTo([]byte("miss"+fillContainerWithNumber(index, 10)), remote)
+// notify sends a message if there is a channel, the library API does not print the messages
+func notify(msg chan string, message string) {
+	if msg != nil {
+		msg <- message
+	}
+}
+
+func requestMissing(conn net.PacketConn, index int, remote net.Addr, session string) (err error) {
+	_, err = conn.WriteTo(controlFrame("miss", session, index), remote)
 	return
 }
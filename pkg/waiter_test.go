@@ -0,0 +1,152 @@
+package pkg
+
+import (
+	"net"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChunkWriter(t *testing.T) {
+	dir := t.TempDir()
+	original, err := os.Create(path.Join(dir, "original"))
+	assert.Nil(t, err)
+	defer func() {
+		_ = original.Close()
+	}()
+	_, err = original.Write([]byte("0123456789abcdefghij"))
+	assert.Nil(t, err)
+
+	f, err := os.Create(path.Join(dir, "file"))
+	assert.Nil(t, err)
+	defer func() {
+		_ = f.Close()
+	}()
+	assert.Nil(t, allocateFile(f, 40, false))
+
+	writer := &chunkWriter{f: f, original: original, session: "session1", mapBuffer: NewSafeMap(4)}
+	tests := []struct {
+		name    string
+		header  dataHeader
+		wantErr bool
+	}{{
+		name:    "another session",
+		header:  dataHeader{session: "session0", chrunk: 10, index: 0, data: []byte("xxxxxxxxxx")},
+		wantErr: true,
+	}, {
+		name:   "data",
+		header: dataHeader{session: "session1", chrunk: 10, index: 0, data: []byte("hello data")},
+	}, {
+		name:   "copy",
+		header: dataHeader{session: "session1", chrunk: 10, index: 1, codec: codecCopy, data: []byte("1")},
+	}, {
+		name:   "hole",
+		header: dataHeader{session: "session1", chrunk: 10, index: 2, codec: codecHole, data: []byte("?")},
+	}, {
+		name:    "copy out of the original",
+		header:  dataHeader{session: "session1", chrunk: 10, index: 3, codec: codecCopy, data: []byte("5")},
+		wantErr: true,
+	}}
+	assert.Nil(t, writer.failure())
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := writer.write(tt.header)
+			assert.Equal(t, tt.wantErr, err != nil, "failed in case [%d]", i)
+		})
+	}
+
+	assert.Equal(t, []int{3}, writer.mapBuffer.GetKeys())
+	assert.NotNil(t, writer.failure(), "it should fail once the block could not be copied")
+	data, err := os.ReadFile(f.Name())
+	assert.Nil(t, err)
+	assert.Equal(t, "hello dataabcdefghij", string(data[:20]))
+	assert.True(t, isZero(data[20:]))
+}
+
+func TestChunkWriterHole(t *testing.T) {
+	f := &memoryFile{data: []byte("xxxxxxxxxxxxxxx")}
+	writer := &chunkWriter{f: f, session: "session1", mapBuffer: NewSafeMap(2)}
+	// the holes are written as zeros since the writer might have the data of a previous file
+	assert.Nil(t, writer.write(dataHeader{session: "session1", length: 15, chrunk: 10, index: 0, codec: codecHole}))
+	assert.Nil(t, writer.write(dataHeader{session: "session1", length: 15, chrunk: 10, index: 1, codec: codecHole}))
+	assert.Equal(t, make([]byte, 15), f.data)
+	assert.Equal(t, 0, writer.mapBuffer.Size())
+}
+
+func TestTrustedPeers(t *testing.T) {
+	_, err := ParseTrustedPeers([]string{"192.168.1.2", "invalid"})
+	assert.NotNil(t, err)
+
+	trusted, err := ParseTrustedPeers([]string{"192.168.1.2", "10.0.0.0/8", "fd00::1"})
+	assert.Nil(t, err)
+	tests := []struct {
+		addr    net.Addr
+		trusted []*net.IPNet
+		wantErr bool
+	}{{
+		addr:    &net.UDPAddr{IP: net.ParseIP("192.168.1.3"), Port: 3000},
+		trusted: nil,
+	}, {
+		addr:    &net.UDPAddr{IP: net.ParseIP("192.168.1.2"), Port: 3000},
+		trusted: trusted,
+	}, {
+		addr:    &net.TCPAddr{IP: net.ParseIP("10.1.2.3"), Port: 3000},
+		trusted: trusted,
+	}, {
+		addr:    &net.UDPAddr{IP: net.ParseIP("fd00::1"), Port: 3000},
+		trusted: trusted,
+	}, {
+		addr:    &net.UDPAddr{IP: net.ParseIP("192.168.1.3"), Port: 3000},
+		trusted: trusted,
+		wantErr: true,
+	}, {
+		addr:    &net.UDPAddr{IP: net.ParseIP("fd00::2"), Port: 3000},
+		trusted: trusted,
+		wantErr: true,
+	}}
+	for i, tt := range tests {
+		err := checkTrusted(tt.addr, tt.trusted)
+		assert.Equal(t, tt.wantErr, err != nil, "failed in case [%d]", i)
+	}
+}
+
+func TestMissRequestDue(t *testing.T) {
+	now := time.Now()
+	request := &missRequest{}
+	tests := []struct {
+		name string
+		now  time.Time
+		want bool
+	}{{
+		name: "first request",
+		now:  now,
+		want: true,
+	}, {
+		name: "on the way",
+		now:  now.Add(missBackoff / 2),
+	}, {
+		name: "backoff is over",
+		now:  now.Add(missBackoff),
+		want: true,
+	}, {
+		name: "the backoff doubles",
+		now:  now.Add(missBackoff * 2),
+	}, {
+		name: "the doubled backoff is over",
+		now:  now.Add(missBackoff * 3),
+		want: true,
+	}}
+	for i, tt := range tests {
+		assert.Equal(t, tt.want, request.due(tt.now), "failed in case [%d]", i)
+	}
+
+	// the backoff is not longer than the max one
+	for i := 0; i < 10; i++ {
+		now = now.Add(maxMissBackoff)
+		assert.True(t, request.due(now))
+	}
+	assert.Equal(t, maxMissBackoff, request.backoff)
+}
@@ -10,6 +10,8 @@ import (
 	"github.com/linuxsuren/transfer/pkg"
 	"github.com/linuxsuren/transfer/ui/server"
 	"log"
+	"net"
+	"strconv"
 )
 
 func main() {
@@ -77,7 +79,14 @@ func main() {
 		case "send":
 			file := data["message"]
 			if file != "" {
-				sender := pkg.NewUDPSender(data["ip"])
+				// the address of the waiter has its announced port
+				host, port, splitErr := net.SplitHostPort(data["ip"])
+				if splitErr != nil {
+					_ = sendMsg("log", fmt.Sprintf("invalid waiter address %q, %v\n", data["ip"], splitErr), w)
+					return
+				}
+				portNum, _ := strconv.Atoi(port)
+				sender := pkg.NewUDPSender(host).WithPort(portNum)
 				msg := make(chan string, 10)
 
 				go func() {
@@ -95,21 +104,21 @@ func main() {
 		}
 		return
 	})
-	_ = pkg.Broadcast(context.TODO())
+	_ = pkg.Broadcast(context.TODO(), pkg.NewLocalPeer("", 3000))
 
 	w.On(astilectron.EventNameAppClose, func(e astilectron.Event) (deleteListener bool) {
 		cancel()
 		return
 	})
-	waiter := make(chan string, 10)
+	waiter := make(chan pkg.Peer, 10)
 	pkg.FindWaiters(ctx, waiter)
 	go func() {
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			case ip := <-waiter:
-				_ = sendMsg("ip", ip, w)
+			case peer := <-waiter:
+				_ = sendMsg("ip", peer.Address(), w)
 			}
 		}
 	}()